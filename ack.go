@@ -0,0 +1,170 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAckDisconnected is returned when the socket disconnected from the namespace before the ack arrived
+var ErrAckDisconnected = errors.New("Socket.IO: socket disconnected before the ack arrived")
+
+// AckTimeoutError is returned by EmitWithAckContext and passed to the AckFunc when the ack did not arrive in time
+type AckTimeoutError struct {
+	Event   string
+	Timeout time.Duration
+}
+
+var _ error = (*AckTimeoutError)(nil)
+
+func (e *AckTimeoutError) Error() string {
+	return fmt.Sprintf("Socket.IO: ack of event %q timed out after %s", e.Event, e.Timeout)
+}
+
+// AckFunc receives the arguments of the ack, or *AckTimeoutError if the ack did not arrive in time,
+// or ErrAckDisconnected if the socket disconnected before it
+type AckFunc func(args []any, err error)
+
+// pendingAck is an emitted event waiting for its ack
+type pendingAck struct {
+	id      int
+	event   string
+	timeout time.Duration
+	ch      chan []any
+	timer   *time.Timer
+	err     error // set before ch is closed without a value
+}
+
+// WithAckTimeout sets the default timeout of the events which expect an ack,
+// including the RPC calls and the reliable events. Use Socket.Timeout to override it for a single emit.
+// When the ack did not arrive in time, the pending ack is removed and its channel is closed
+func WithAckTimeout(timeout time.Duration) Option {
+	return func(s *Socket) {
+		s.ackTimeout = timeout
+	}
+}
+
+// AckEmitter emits events with a specific ack timeout, see Socket.Timeout
+type AckEmitter struct {
+	s       *Socket
+	timeout time.Duration
+}
+
+// Timeout returns an AckEmitter which overrides the default ack timeout,
+// zero or a negative timeout waits for the ack until the socket is closed
+func (s *Socket) Timeout(timeout time.Duration) AckEmitter {
+	return AckEmitter{
+		s:       s,
+		timeout: timeout,
+	}
+}
+
+// EmitWithAck is like Socket.EmitWithAck but uses the timeout of the emitter
+func (e AckEmitter) EmitWithAck(event string, args ...any) (<-chan []any, error) {
+	ack, err := e.s.emitWithAck(context.Background(), event, args, e.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return ack.ch, nil
+}
+
+// EmitWithAckContext is like Socket.EmitWithAckContext but uses the timeout of the emitter
+func (e AckEmitter) EmitWithAckContext(ctx context.Context, event string, args ...any) ([]any, error) {
+	ack, err := e.s.emitWithAck(ctx, event, args, e.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return e.s.waitAck(ctx, ack)
+}
+
+// EmitWithAckFunc is like Socket.EmitWithAckFunc but uses the timeout of the emitter
+func (e AckEmitter) EmitWithAckFunc(event string, cb AckFunc, args ...any) error {
+	ack, err := e.s.emitWithAck(context.Background(), event, args, e.timeout)
+	if err != nil {
+		return err
+	}
+	go func() {
+		cb(e.s.waitAck(context.Background(), ack))
+	}()
+	return nil
+}
+
+// EmitWithAckContext sends the event and waits for the ack arguments.
+// It returns *AckTimeoutError if the ack did not arrive within the timeout set by WithAckTimeout,
+// ErrAckDisconnected if the socket disconnected before it, or the error of ctx
+func (s *Socket) EmitWithAckContext(ctx context.Context, event string, args ...any) ([]any, error) {
+	return s.Timeout(s.ackTimeout).EmitWithAckContext(ctx, event, args...)
+}
+
+// EmitWithAckFunc sends the event and calls cb in a new goroutine with the ack arguments,
+// or with the same errors as EmitWithAckContext
+func (s *Socket) EmitWithAckFunc(event string, cb AckFunc, args ...any) error {
+	return s.Timeout(s.ackTimeout).EmitWithAckFunc(event, cb, args...)
+}
+
+// waitAck waits for the ack, and stops waiting for it when ctx is done
+func (s *Socket) waitAck(ctx context.Context, ack *pendingAck) ([]any, error) {
+	select {
+	case args, ok := <-ack.ch:
+		if !ok {
+			return nil, ack.err
+		}
+		return args, nil
+	case <-ctx.Done():
+		s.cancelAck(ack.id)
+		return nil, ctx.Err()
+	}
+}
+
+// takeAckLocked removes the ack from the pending acks and stops its timer, ackMux must be held
+func (s *Socket) takeAckLocked(id int) (ack *pendingAck) {
+	if ack = s.ackChan[id]; ack == nil {
+		return
+	}
+	delete(s.ackChan, id)
+	s.releaseWindow(id)
+	if ack.timer != nil {
+		ack.timer.Stop()
+	}
+	return
+}
+
+// expireAck stops waiting for the ack and closes its channel with *AckTimeoutError if it is still pending
+func (s *Socket) expireAck(ack *pendingAck) {
+	s.ackMux.Lock()
+	defer s.ackMux.Unlock()
+	if s.ackChan[ack.id] == ack {
+		s.takeAckLocked(ack.id)
+		ack.err = &AckTimeoutError{Event: ack.event, Timeout: ack.timeout}
+		close(ack.ch)
+	}
+}
+
+// failAcksLocked closes the channels of all pending acks with err, ackMux must be held
+func (s *Socket) failAcksLocked(err error) {
+	for id := range s.ackChan {
+		ack := s.takeAckLocked(id)
+		ack.err = err
+		close(ack.ch)
+	}
+}
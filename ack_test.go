@@ -0,0 +1,88 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package socket_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	socket "github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/socketiotest"
+)
+
+func TestAckTimeoutError(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, _ := connect(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.Timeout(50*time.Millisecond).EmitWithAckContext(ctx, "unanswered")
+	var te *socket.AckTimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("EmitWithAckContext returned %v, want *AckTimeoutError", err)
+	}
+	if te.Event != "unanswered" || te.Timeout != 50*time.Millisecond {
+		t.Errorf("unexpected timeout error %+v", te)
+	}
+}
+
+func TestAckFailsOnDisconnect(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, c := connect(t, srv)
+
+	errCh := make(chan error, 1)
+	if err := s.EmitWithAckFunc("unanswered", func(args []any, err error) {
+		errCh <- err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := srv.WaitEvent(ctx, "unanswered"); err != nil {
+		t.Fatal(err)
+	}
+	c.Disconnect("/")
+	select {
+	case err := <-errCh:
+		if err != socket.ErrAckDisconnected {
+			t.Fatalf("ack failed with %v, want ErrAckDisconnected", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the pending ack was not failed after disconnect")
+	}
+}
+
+func TestSendWindowHonorsContext(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, _ := connect(t, srv, socket.WithSendWindow(1))
+
+	if _, err := s.EmitWithAck("unanswered"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.EmitWithAckContext(ctx, "blocked"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("EmitWithAckContext returned %v with a full window, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,104 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"encoding/json"
+)
+
+// Arg is a lazily decoded event argument, see OnRawMessage
+type Arg struct {
+	raw     json.RawMessage
+	attachs [][]byte
+}
+
+var _ json.Marshaler = Arg{}
+
+// Raw returns the JSON encoding of the argument
+func (a Arg) Raw() json.RawMessage {
+	return a.raw
+}
+
+// As decodes the argument into ptr, Buffer fields receive the binary attachments
+func (a Arg) As(ptr any) (err error) {
+	p := Packet{data: a.raw, attachs: a.attachs}
+	return p.UnmarshalData(ptr)
+}
+
+func (a Arg) MarshalJSON() ([]byte, error) {
+	if a.raw == nil {
+		return []byte("null"), nil
+	}
+	return a.raw, nil
+}
+
+// OnRawMessage registers the callback which receives the arguments of the events undecoded,
+// so handlers only pay for the arguments they decode with Arg.As.
+// When payload codecs are set, the arguments are decoded by the codecs first and re-encoded
+func (s *Socket) OnRawMessage(cb func(event string, args []Arg)) {
+	s.rawMessageHandlers.On(cb)
+}
+
+func (s *Socket) OnceRawMessage(cb func(event string, args []Arg)) {
+	s.rawMessageHandlers.Once(cb)
+}
+
+// receivedEvent is a received event after its payload was decoded by the codecs,
+// it is passed to the builtin consumers like Register, Reliable and StreamReader
+type receivedEvent struct {
+	namespace string
+	id        int // -1 if no ack is expected
+	name      string
+	args      []Arg
+	// decoded are the values of args if they were already decoded for OnMessage
+	decoded []any
+}
+
+// values returns the arguments as generic values
+func (e *receivedEvent) values() ([]any, error) {
+	if e.decoded != nil {
+		return e.decoded, nil
+	}
+	return argValues(e.args)
+}
+
+// argValues decodes the arguments into generic values
+func argValues(args []Arg) (values []any, err error) {
+	values = make([]any, len(args))
+	for i, a := range args {
+		if err = a.As(&values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// onReceivedEvent registers the callback of the decoded events, it returns the cancel function
+func (s *Socket) onReceivedEvent(cb func(s *Socket, e *receivedEvent)) func() {
+	return s.eventHandlers.On(cb)
+}
+
+func newArgs(raw []json.RawMessage, attachs [][]byte) []Arg {
+	args := make([]Arg, len(raw))
+	for i, r := range raw {
+		args[i] = Arg{raw: r, attachs: attachs}
+	}
+	return args
+}
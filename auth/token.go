@@ -0,0 +1,123 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	socket "github.com/ahollic/socket.io"
+)
+
+// RefreshFunc returns a new token, old is the token used by the previous connection
+type RefreshFunc = func(ctx context.Context, old string) (string, error)
+
+// Token holds a bearer token which is refreshed before each reconnect
+type Token struct {
+	mux     sync.Mutex
+	token   string
+	used    bool
+	refresh RefreshFunc
+}
+
+// NewToken creates a Token, the initial token is used by the first connection.
+// If initial is empty, refresh will be called for the first connection as well
+func NewToken(initial string, refresh RefreshFunc) *Token {
+	return &Token{
+		token:   initial,
+		refresh: refresh,
+	}
+}
+
+// Get returns the current token without refreshing it
+func (t *Token) Get() string {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.token
+}
+
+// Refresh calls the refresh callback and stores the new token
+func (t *Token) Refresh(ctx context.Context) (token string, err error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.refreshLocked(ctx)
+}
+
+func (t *Token) refreshLocked(ctx context.Context) (token string, err error) {
+	if t.refresh == nil {
+		return t.token, nil
+	}
+	if token, err = t.refresh(ctx, t.token); err != nil {
+		return
+	}
+	t.token = token
+	return
+}
+
+// Next returns the token for a new connection attempt,
+// it refreshes the token unless the initial token was not used yet
+func (t *Token) Next(ctx context.Context) (token string, err error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if !t.used && t.token != "" {
+		t.used = true
+		return t.token, nil
+	}
+	t.used = true
+	return t.refreshLocked(ctx)
+}
+
+// Header returns an Authorization header carrying the current token
+func (t *Token) Header() http.Header {
+	h := make(http.Header, 1)
+	h.Set("Authorization", "Bearer "+t.Get())
+	return h
+}
+
+// HeaderProvider returns an engine.Options.HeaderProvider which sends the token
+// as an Authorization header, the token is refreshed before each reconnect.
+// Use either HeaderProvider or WithToken for the same Token, not both
+func HeaderProvider(t *Token) func(ctx context.Context) (http.Header, error) {
+	return func(ctx context.Context) (http.Header, error) {
+		token, err := t.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		h := make(http.Header, 1)
+		h.Set("Authorization", "Bearer "+token)
+		return h, nil
+	}
+}
+
+// WithToken puts the token into the auth payload of every CONNECT packet as "token",
+// the token is refreshed before each reconnect
+func WithToken(t *Token) socket.Option {
+	return WithTokenKey("token", t)
+}
+
+// WithTokenKey is like WithToken but uses key as the name in the auth payload
+func WithTokenKey(key string, t *Token) socket.Option {
+	return socket.WithAuth(map[string]any{
+		key: func(*socket.Socket) (string, error) {
+			return t.Next(context.Background())
+		},
+	})
+}
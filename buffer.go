@@ -25,7 +25,10 @@ import (
 	"reflect"
 )
 
-var errNotPlaceHolder = errors.New("socket.io: require `{ _placeholder: true, num: <number> }` in order to unmarshal socket.Buffer")
+var (
+	errNotPlaceHolder  = errors.New("socket.io: require `{ _placeholder: true, num: <number> }` in order to unmarshal socket.Buffer")
+	errAttachmentIndex = errors.New("Socket.IO: placeholder refers to a missing attachment")
+)
 
 type Buffer struct {
 	B   []byte
@@ -111,8 +114,16 @@ func (p *Packet) _encodeAttachs(v reflect.Value, recurse bool, encoded map[*Buff
 			recurse = et.Kind() != reflect.Interface
 			p._encodeAttachs(v.Elem(), recurse, encoded)
 		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			p._encodeAttachs(v.Elem(), false, encoded)
+		}
 	case reflect.Struct:
 		if typ == bufferTyp {
+			if !v.CanAddr() {
+				// Buffer must be passed by pointer inside an interface
+				return
+			}
 			b := v.Addr().Interface().(*Buffer)
 			if _, ok := encoded[b]; !ok {
 				encoded[b] = struct{}{}
@@ -128,53 +139,64 @@ func (p *Packet) _encodeAttachs(v reflect.Value, recurse bool, encoded map[*Buff
 	}
 }
 
-func (p *Packet) decodeAttachs(ptr any) {
-	p._decodeAttachs(reflect.ValueOf(ptr), false)
+func (p *Packet) decodeAttachs(ptr any) error {
+	return p._decodeAttachs(reflect.ValueOf(ptr), false)
 }
 
-func (p *Packet) _decodeAttachs(v reflect.Value, recurse bool) {
+func (p *Packet) _decodeAttachs(v reflect.Value, recurse bool) (err error) {
 	typ := v.Type()
 	switch typ.Kind() {
 	case reflect.Array:
 		if et := typ.Elem(); recurse || needCheckForBufferType(et) {
 			recurse = et.Kind() != reflect.Interface
 			l := typ.Len()
-			for i := 0; i < l; i++ {
-				p._decodeAttachs(v.Index(i), recurse)
+			for i := 0; i < l && err == nil; i++ {
+				err = p._decodeAttachs(v.Index(i), recurse)
 			}
 		}
 	case reflect.Slice:
 		if et := typ.Elem(); recurse || needCheckForBufferType(et) {
 			recurse = et.Kind() != reflect.Interface
 			l := v.Len()
-			for i := 0; i < l; i++ {
-				p._decodeAttachs(v.Index(i), recurse)
+			for i := 0; i < l && err == nil; i++ {
+				err = p._decodeAttachs(v.Index(i), recurse)
 			}
 		}
 	case reflect.Map:
 		if et := typ.Elem(); recurse || needCheckForBufferType(et) {
 			recurse = et.Kind() != reflect.Interface
 			iter := v.MapRange()
-			for iter.Next() {
-				p._decodeAttachs(iter.Value(), recurse)
+			for iter.Next() && err == nil {
+				err = p._decodeAttachs(iter.Value(), recurse)
 			}
 		}
 	case reflect.Pointer:
 		if et := typ.Elem(); (recurse || needCheckForBufferType(et)) && !v.IsNil() {
 			recurse = et.Kind() != reflect.Interface
-			p._decodeAttachs(v.Elem(), recurse)
+			err = p._decodeAttachs(v.Elem(), recurse)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			err = p._decodeAttachs(v.Elem(), false)
 		}
 	case reflect.Struct:
 		if typ == bufferTyp {
+			if !v.CanAddr() {
+				return
+			}
 			b := v.Addr().Interface().(*Buffer)
+			if b.num > (uint)(len(p.attachs)) {
+				return errAttachmentIndex
+			}
 			if b.num > 0 {
 				b.B = p.attachs[b.num-1]
 			}
 			return
 		}
 		l := typ.NumField()
-		for i := 0; i < l; i++ {
-			p._decodeAttachs(v.Field(i), false)
+		for i := 0; i < l && err == nil; i++ {
+			err = p._decodeAttachs(v.Field(i), false)
 		}
 	}
+	return
 }
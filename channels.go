@@ -0,0 +1,41 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"github.com/ahollic/socket.io/internal/utils"
+)
+
+// Event is a received event
+type Event struct {
+	Name string
+	Args []any
+}
+
+// Events returns a channel which receives the events of the namespace, size is the buffer size of the channel.
+// The reader blocks while the channel is full, so the channel must be drained.
+// stop unregisters and closes the channel, it must not be called from a callback of the socket
+func (s *Socket) Events(size int) (events <-chan Event, stop func()) {
+	c := utils.NewChan[Event](size)
+	cancel := s.messageHandlers.On(func(name string, args []any) {
+		c.Send(Event{Name: name, Args: args})
+	})
+	return c.C(), func() { c.Stop(cancel) }
+}
@@ -0,0 +1,229 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// socketgen generates typed Emit and On wrappers of a socket.Socket from an event contract.
+//
+// Usage:
+//
+//	//go:generate go run github.com/ahollic/socket.io/cmd/socketgen -in events.json -out events_gen.go
+//
+// The contract is a JSON file:
+//
+//	{
+//	  "package": "chat",
+//	  "types": {
+//	    "User": [{"name": "Name", "type": "string", "json": "name"}]
+//	  },
+//	  "emits": {
+//	    "send message": [{"name": "text", "type": "string"}]
+//	  },
+//	  "listens": {
+//	    "user joined": [{"name": "user", "type": "User"}]
+//	  }
+//	}
+//
+// Emits are the events sent by the client, listens are the events received from the server.
+// The types of the arguments are Go types, or the names of the declared types
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	JSON string `json:"json,omitempty"`
+}
+
+type Contract struct {
+	Package string             `json:"package"`
+	Types   map[string][]Field `json:"types"`
+	Emits   map[string][]Field `json:"emits"`
+	Listens map[string][]Field `json:"listens"`
+}
+
+type namedFields struct {
+	Name   string
+	Event  string
+	Fields []Field
+}
+
+func sorted(m map[string][]Field, name func(string) string) []namedFields {
+	list := make([]namedFields, 0, len(m))
+	for k, v := range m {
+		list = append(list, namedFields{Name: name(k), Event: k, Fields: v})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Event < list[j].Event })
+	return list
+}
+
+// goName converts an event name like "user joined" or "user-joined" to UserJoined
+func goName(event string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range event {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func identity(s string) string { return s }
+
+var tmpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+}).Parse(`// Code generated by socketgen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	socket "github.com/ahollic/socket.io"
+)
+{{range .Types}}
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}}{{if .JSON}} ` + "`json:{{quote .JSON}}`" + `{{end}}
+{{- end}}
+}
+{{end}}
+// Client wraps the socket with the typed events of the contract
+type Client struct {
+	Socket *socket.Socket
+	// OnDecodeError is called when the arguments of a received event cannot be decoded
+	OnDecodeError func(event string, err error)
+}
+
+func NewClient(s *socket.Socket) *Client {
+	return &Client{Socket: s}
+}
+
+func (c *Client) decodeError(event string, err error) {
+	if c.OnDecodeError != nil {
+		c.OnDecodeError(event, err)
+	}
+}
+{{range .Emits}}
+// Emit{{.Name}} emits the {{quote .Event}} event
+func (c *Client) Emit{{.Name}}({{range $i, $f := .Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}}) error {
+	return c.Socket.Emit({{quote .Event}}{{range .Fields}}, {{.Name}}{{end}})
+}
+{{end}}{{range .Listens}}
+// On{{.Name}} registers the callback of the {{quote .Event}} event
+func (c *Client) On{{.Name}}(cb func({{range $i, $f := .Fields}}{{if $i}}, {{end}}{{$f.Name}} {{$f.Type}}{{end}})) {
+	c.Socket.OnRawMessage(func(event string, args []socket.Arg) {
+		if event != {{quote .Event}} {
+			return
+		}
+{{- if .Fields}}
+		if len(args) < {{len .Fields}} {
+			c.decodeError(event, &socket.ArgCountError{Want: {{len .Fields}}, Got: len(args)})
+			return
+		}
+{{- end}}
+{{- range $i, $f := .Fields}}
+		var {{$f.Name}} {{$f.Type}}
+		if err := args[{{$i}}].As(&{{$f.Name}}); err != nil {
+			c.decodeError(event, err)
+			return
+		}
+{{- end}}
+		cb({{range $i, $f := .Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}})
+	})
+}
+{{end}}`))
+
+// reserved are the identifiers used by the generated wrappers
+var reserved = map[string]bool{"c": true, "cb": true, "event": true, "args": true, "err": true, "socket": true}
+
+func generate(c *Contract) ([]byte, error) {
+	if c.Package == "" {
+		return nil, fmt.Errorf("package is required")
+	}
+	for _, events := range []map[string][]Field{c.Emits, c.Listens} {
+		for event, fields := range events {
+			for _, f := range fields {
+				if reserved[f.Name] {
+					return nil, fmt.Errorf("argument name %q of event %q is reserved", f.Name, event)
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]any{
+		"Package": c.Package,
+		"Types":   sorted(c.Types, identity),
+		"Emits":   sorted(c.Emits, goName),
+		"Listens": sorted(c.Listens, goName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func main() {
+	in := flag.String("in", "", "the JSON contract file")
+	out := flag.String("out", "", "the output Go file, default to stdout")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "socketgen:", err)
+		os.Exit(1)
+	}
+	var contract Contract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		fmt.Fprintf(os.Stderr, "socketgen: cannot parse %s: %v\n", *in, err)
+		os.Exit(1)
+	}
+	src, err := generate(&contract)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "socketgen:", err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "socketgen:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"fmt"
+)
+
+// PayloadCodec transforms the arguments of events, e.g. to encrypt or sign them.
+// Encode is called before an event is sent, and Decode after an event is received.
+// The arguments of acks are not transformed
+type PayloadCodec interface {
+	Encode(event string, args []any) ([]any, error)
+	Decode(event string, args []any) ([]any, error)
+}
+
+// PayloadError is reported by OnError when a received event cannot be decoded,
+// the event is dropped
+type PayloadError struct {
+	Event string
+	Err   error
+}
+
+var _ error = (*PayloadError)(nil)
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("Socket.IO: cannot decode payload of event %q: %v", e.Event, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// WithPayloadCodec adds the codec to the socket.
+// Codecs encode in the order they were added and decode in the reverse order
+func WithPayloadCodec(codec PayloadCodec) Option {
+	return func(s *Socket) {
+		s.codecs = append(s.codecs, codec)
+	}
+}
+
+func (s *Socket) encodePayload(event string, args []any) (_ []any, err error) {
+	if args, err = s.marshalArgs(event, args); err != nil {
+		return
+	}
+	for _, c := range s.codecs {
+		if args, err = c.Encode(event, args); err != nil {
+			return
+		}
+	}
+	return args, nil
+}
+
+func (s *Socket) decodePayload(event string, args []any) (_ []any, err error) {
+	for i := len(s.codecs) - 1; i >= 0; i-- {
+		if args, err = s.codecs[i].Decode(event, args); err != nil {
+			return nil, &PayloadError{Event: event, Err: err}
+		}
+	}
+	return args, nil
+}
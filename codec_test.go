@@ -0,0 +1,138 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	socket "github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/ahollic/socket.io/socketiotest"
+)
+
+// wrapCodec wraps the arguments into {"w": args}
+type wrapCodec struct{}
+
+func (wrapCodec) Encode(event string, args []any) ([]any, error) {
+	return []any{map[string]any{"w": args}}, nil
+}
+
+func (wrapCodec) Decode(event string, args []any) ([]any, error) {
+	if len(args) == 1 {
+		if m, ok := args[0].(map[string]any); ok {
+			if w, ok := m["w"].([]any); ok {
+				return w, nil
+			}
+		}
+	}
+	return nil, errors.New("not wrapped")
+}
+
+func wrap(args ...any) map[string]any {
+	return map[string]any{"w": args}
+}
+
+// connect dials a socket to srv and returns the server side of the connection
+func connect(t *testing.T, srv *socketiotest.Server, opts ...socket.Option) (*socket.Socket, *socketiotest.Conn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	io, err := engine.NewSocket(srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := socket.NewSocket(io, opts...)
+	t.Cleanup(func() {
+		io.Close()
+	})
+	if err := io.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ConnectAndWait(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestRegisterWithCodec(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, c := connect(t, srv, socket.WithPayloadCodec(wrapCodec{}))
+
+	type addReq struct {
+		A, B int
+	}
+	socket.Register(s, "add", func(ctx context.Context, req addReq) (int, error) {
+		return req.A + req.B, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := c.EmitWithAck(ctx, "/", "add", wrap(addReq{A: 1, B: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || string(res[0]) != "null" || string(res[1]) != "3" {
+		t.Fatalf("unexpected ack %s", res)
+	}
+}
+
+func TestReliableWithCodec(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, c := connect(t, srv, socket.WithPayloadCodec(wrapCodec{}))
+
+	r := socket.NewReliable(s, 0)
+	got := make(chan []any, 2)
+	r.OnMessage(func(event string, args []any) {
+		got <- append([]any{event}, args...)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		// the duplicate must be acked but not delivered again
+		if _, err := c.EmitWithAck(ctx, "/", socket.ReliableEvent, wrap("peer-1", "greet", "hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case args := <-got:
+		b, _ := json.Marshal(args)
+		if string(b) != `["greet","hi"]` {
+			t.Fatalf("unexpected event %s", b)
+		}
+	case <-ctx.Done():
+		t.Fatal("reliable event was not delivered")
+	}
+	select {
+	case args := <-got:
+		t.Fatalf("duplicate delivered: %v", args)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,189 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package socket_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	socket "github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+// The conformance tests run against an external Socket.IO server, by default the reference server in
+// testdata/conformance/server.js. They are skipped unless SOCKETIO_CONFORMANCE_HOST is set to its host,
+// SOCKETIO_CONFORMANCE_PATH overrides the path "/socket.io/".
+//
+// The server must echo the "echo" event, ack the "ack" event with its arguments,
+// and close the transport on "close-transport" in both the main and the /custom namespace.
+// The recovery test also needs connection state recovery to be enabled
+
+type conformanceClient struct {
+	io *engine.Socket
+	s  *socket.Socket
+}
+
+func conformanceOptions(t *testing.T) engine.Options {
+	t.Helper()
+	host := os.Getenv("SOCKETIO_CONFORMANCE_HOST")
+	if host == "" {
+		t.Skip("SOCKETIO_CONFORMANCE_HOST is not set")
+	}
+	path := os.Getenv("SOCKETIO_CONFORMANCE_PATH")
+	if path == "" {
+		path = "/socket.io/"
+	}
+	return engine.Options{
+		Host: host,
+		Path: path,
+	}
+}
+
+func dialConformance(t *testing.T, ctx context.Context, opts engine.Options, namespace string) *conformanceClient {
+	t.Helper()
+	io, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		io.Close()
+	})
+	c := &conformanceClient{
+		io: io,
+		s:  socket.NewSocket(io),
+	}
+	if err := io.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.s.ConnectAndWait(ctx, namespace); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// echo emits the echo event and waits until the server emits it back
+func (c *conformanceClient) echo(t *testing.T, ctx context.Context, args ...any) []socket.Arg {
+	t.Helper()
+	ch := make(chan []socket.Arg, 1)
+	c.s.OnceRawMessage(func(event string, args []socket.Arg) {
+		if event == "echo" {
+			ch <- args
+		}
+	})
+	if err := c.s.Emit("echo", args...); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-ch:
+		return res
+	case <-ctx.Done():
+		t.Fatal("the echo did not arrive")
+		return nil
+	}
+}
+
+// reconnect asks the server to close the transport and waits until the socket reconnected
+func (c *conformanceClient) reconnect(t *testing.T, ctx context.Context) {
+	t.Helper()
+	reconnected := make(chan struct{}, 1)
+	c.s.OnceReconnect(func(*socket.Socket) {
+		reconnected <- struct{}{}
+	})
+	if err := c.s.Emit("close-transport"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reconnected:
+	case <-ctx.Done():
+		t.Fatal("the socket did not reconnect")
+	}
+}
+
+func sameJSON(t *testing.T, want any, got any) {
+	t.Helper()
+	w, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w, g) {
+		t.Fatalf("expect %s, got %s", w, g)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	opts := conformanceOptions(t)
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, c *conformanceClient)
+	}{
+		{"Event", func(t *testing.T, ctx context.Context, c *conformanceClient) {
+			args := []any{"hello", 1.5, map[string]any{"a": []any{true, nil}}}
+			sameJSON(t, args, c.echo(t, ctx, args...))
+		}},
+		{"Ack", func(t *testing.T, ctx context.Context, c *conformanceClient) {
+			res, err := c.s.EmitWithAckContext(ctx, "ack", "a", 2.0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameJSON(t, []any{"a", 2.0}, res)
+		}},
+		{"Binary", func(t *testing.T, ctx context.Context, c *conformanceClient) {
+			data := []byte{0, 1, 2, 0xfe, 0xff}
+			res := c.echo(t, ctx, &socket.Buffer{B: data}, "tail")
+			if len(res) != 2 {
+				t.Fatalf("expect 2 arguments, got %d", len(res))
+			}
+			var buf socket.Buffer
+			if err := res[0].As(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.B, data) {
+				t.Fatalf("expect attachment %x, got %x", data, buf.B)
+			}
+		}},
+		{"Namespace", func(t *testing.T, ctx context.Context, _ *conformanceClient) {
+			c := dialConformance(t, ctx, opts, "/custom")
+			sameJSON(t, []any{"custom"}, c.echo(t, ctx, "custom"))
+		}},
+		{"Reconnection", func(t *testing.T, ctx context.Context, c *conformanceClient) {
+			c.reconnect(t, ctx)
+			sameJSON(t, []any{"after"}, c.echo(t, ctx, "after"))
+		}},
+		{"Recovery", func(t *testing.T, ctx context.Context, c *conformanceClient) {
+			c.reconnect(t, ctx)
+			if !c.s.Recovered() {
+				t.Fatal("the connection state was not recovered")
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			tc.run(t, ctx, dialConformance(t, ctx, opts, ""))
+		})
+	}
+}
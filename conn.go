@@ -25,9 +25,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
 	"reflect"
+	"regexp"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ahollic/socket.io/engine.io"
 	"github.com/ahollic/socket.io/internal/utils"
@@ -38,6 +42,8 @@ var (
 	errNotString    = errors.New("Socket.IO: the first argument must be a event name string")
 	errRecvText     = errors.New("Socket.IO: got plaintext data when reconstructing a packet")
 	errRecvByte     = errors.New("Socket.IO: got binary data when not reconstructing a packet")
+	errNotConnected = errors.New("Socket.IO: socket is not connected")
+	errDisconnected = errors.New("Socket.IO: socket disconnected")
 )
 
 type ConnectError struct {
@@ -68,23 +74,52 @@ type Socket struct {
 	autoReconnect bool
 	auth          map[string]any
 	lastOffset    string
+	recovered     bool
+	// autoConnected is set when a v2 server connected the main namespace before Connect was called
+	autoConnected bool
+
+	disconnectReason engine.DisconnectReason
 
 	packet               Packet
 	reconstructingAttach int
 
+	ctxMux sync.Mutex
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
 	ackMux  sync.Mutex
 	ackId   int
-	ackChan map[int]chan []any
+	ackChan map[int]*pendingAck
+	// window limits the number of un-acked packets, windowIds are the ack ids holding a slot
+	window     chan struct{}
+	windowIds  map[int]struct{}
+	ackTimeout time.Duration
 
 	connectHandles       utils.HandlerList[*Socket, string]
 	disconnectHandles    utils.HandlerList[*Socket, string]
 	beforeConnectHandles utils.HandlerList[*Socket, struct{}]
 	errorHandles         utils.HandlerList[*Socket, error]
 	packetHandlers       utils.HandlerList[*Socket, *Packet]
+	eventHandlers        utils.HandlerList[*Socket, *receivedEvent]
 	messageHandlers      utils.HandlerList[string, []any]
+	rawMessageHandlers   utils.HandlerList[string, []Arg]
 	reconnectHandles     utils.HandlerList[*Socket, struct{}]
 
-	msgbuf [][]byte
+	outgoing   middlewareChain
+	codecs     []PayloadCodec
+	encoders   map[reflect.Type]argEncoder
+	validators map[string]Validator
+
+	emitMux  sync.Mutex
+	msgbuf   []encodedPacket
+	store    Store
+	storeErr error
+}
+
+// encodedPacket is an encoded packet with its binary attachments
+type encodedPacket struct {
+	text    []byte
+	attachs [][]byte
 }
 
 type Option = func(*Socket)
@@ -111,12 +146,78 @@ func WithAuthTokenFn(tokenGen func() (string, error)) Option {
 	}
 }
 
+// WithSendWindow makes EmitWithAck block while n packets are waiting for their acks.
+// A slot is released when its ack arrives, times out, or is dropped.
+// The blocked emit fails with the error of the context of EmitWithAckContext,
+// or when the socket disconnected from the namespace
+func WithSendWindow(n int) Option {
+	return func(s *Socket) {
+		if n > 0 {
+			s.window = make(chan struct{}, n)
+			s.windowIds = make(map[int]struct{}, n)
+		}
+	}
+}
+
+// WithStore persists the packets emitted while the socket is not connected,
+// the packets already in the store are queued and will be flushed after connected.
+// The acks of restored packets are dropped, since their callbacks do not exist anymore:
+// the ack ids are removed from the events, and the ACK packets of the previous session are discarded
+func WithStore(store Store) Option {
+	return func(s *Socket) {
+		s.store = store
+		pkts, err := store.Load()
+		for _, p := range pkts {
+			text, ok := restorePacket(p.Text)
+			if !ok {
+				continue
+			}
+			s.msgbuf = append(s.msgbuf, encodedPacket{
+				text:    text,
+				attachs: p.Attachments,
+			})
+		}
+		s.storeErr = err
+	}
+}
+
+// restorePacket removes the ack id of a stored event, so the ack of a new emit
+// can not be resolved by the response to it. ok is false if the packet should be dropped
+func restorePacket(text []byte) (_ []byte, ok bool) {
+	pkt, err := ParsePacket(text)
+	if err != nil {
+		return nil, false
+	}
+	switch pkt.typ {
+	case EVENT, BINARY_EVENT:
+	default:
+		return nil, false
+	}
+	if pkt.Id() < 0 {
+		return text, true
+	}
+	pkt.SetId(-1)
+	var buf bytes.Buffer
+	if _, err = pkt.WriteTo(&buf); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// NewSocket creates a Socket.IO socket on the Engine.IO socket.
+// It panics if io dispatches with engine.DispatchPool, since the packets and their binary attachments
+// must be handled in the order they were received
 func NewSocket(io *engine.Socket, options ...Option) (s *Socket) {
+	if io.DispatchMode() == engine.DispatchPool {
+		panic("Socket.IO: engine.DispatchPool is not supported, use engine.DispatchOrdered instead")
+	}
 	s = &Socket{
 		io: io,
 
-		ackChan: make(map[int]chan []any),
+		ackChan: make(map[int]*pendingAck),
 	}
+	s.ctx, s.cancel = context.WithCancelCause(context.Background())
+	s.cancel(errNotConnected)
 
 	for _, opt := range options {
 		opt(s)
@@ -135,6 +236,10 @@ func NewSocket(io *engine.Socket, options ...Option) (s *Socket) {
 		}
 	})
 	io.OnDisconnect(func(_ *engine.Socket, err error) {
+		s.mux.Lock()
+		s.autoConnected = false
+		s.mux.Unlock()
+		s.setDisconnectReason(engine.ReasonOf(err))
 		s.disconnected()
 		if err != nil {
 			s.onError(err)
@@ -142,6 +247,7 @@ func NewSocket(io *engine.Socket, options ...Option) (s *Socket) {
 		s.disconnectHandles.Call(s, s.namespace)
 	})
 	io.OnMessage(s.onMessage)
+	io.OnBinary(s.onBinary)
 	return
 }
 
@@ -151,6 +257,28 @@ func (s *Socket) ID() string {
 	return s.sid
 }
 
+// DisconnectReason returns why the socket was disconnected the last time,
+// with the same values as the JS client
+func (s *Socket) DisconnectReason() engine.DisconnectReason {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.disconnectReason
+}
+
+func (s *Socket) setDisconnectReason(reason engine.DisconnectReason) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.disconnectReason = reason
+}
+
+// Recovered reports whether the server restored the state of the namespace on the last connect,
+// the missed events are then received as usual
+func (s *Socket) Recovered() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.recovered
+}
+
 func (s *Socket) Status() SocketStatus {
 	return s.status.Load()
 }
@@ -208,6 +336,21 @@ func (s *Socket) sendConnPkt() error {
 			data[k] = v.Interface()
 		}
 	}
+	if s.legacy() {
+		// the v2 server connects the main namespace by itself,
+		// and receives the auth of the other namespaces as the query
+		if isRootNamespace(s.namespace) {
+			return nil
+		}
+		if len(data) > 0 {
+			query := make(url.Values, len(data))
+			for k, v := range data {
+				query.Set(k, fmt.Sprint(v))
+			}
+			pkt.namespace += "?" + query.Encode()
+		}
+		return s.send(pkt)
+	}
 	if s.pid != "" {
 		data["pid"] = s.pid
 		data["offset"] = s.lastOffset
@@ -220,15 +363,31 @@ func (s *Socket) sendConnPkt() error {
 	return s.send(pkt)
 }
 
+// Connect connects to the namespace, it also returns the error
+// that occurred while loading the packets from the Store
 func (s *Socket) Connect(namespace string) (err error) {
+	var autoConnected bool
+	defer func() {
+		if autoConnected {
+			s.onConnect(&Packet{typ: CONNECT, namespace: namespace})
+		}
+	}()
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
+	if err = s.storeErr; err != nil {
+		s.storeErr = nil
+		return
+	}
+
 	if !s.status.CompareAndSwap(SocketClosed, SocketOpening) {
 		panic("Socket.IO: socket is already connected to a namespce, multiple namespaces is TODO")
 	}
 	s.namespace = namespace
-	if s.io.Connected() {
+	if s.legacy() && isRootNamespace(namespace) && s.autoConnected {
+		s.autoConnected = false
+		autoConnected = true
+	} else if s.io.Connected() {
 		if err = s.sendConnPkt(); err != nil {
 			s.status.Store(SocketClosed)
 			return
@@ -240,8 +399,34 @@ func (s *Socket) Connect(namespace string) (err error) {
 	return
 }
 
+// legacy reports whether the server speaks Socket.IO v2, see engine.ProtocolV3
+func (s *Socket) legacy() bool {
+	return s.io.Protocol() == engine.ProtocolV3
+}
+
+func isRootNamespace(namespace string) bool {
+	return namespace == "" || namespace == "/"
+}
+
 func (s *Socket) disconnected() {
-	s.status.Store(SocketClosed)
+	wasConnected := s.status.Swap(SocketClosed) == SocketConnected
+	s.ctxMux.Lock()
+	s.cancel(errDisconnected)
+	s.ctxMux.Unlock()
+
+	s.ackMux.Lock()
+	// the acks of the packets buffered while not connected are kept, they will be sent after connected
+	if wasConnected {
+		s.failAcksLocked(ErrAckDisconnected)
+	}
+	s.ackMux.Unlock()
+}
+
+// Context returns a context which will be canceled when the socket disconnected from the namespace
+func (s *Socket) Context() context.Context {
+	s.ctxMux.Lock()
+	defer s.ctxMux.Unlock()
+	return s.ctx
 }
 
 func (s *Socket) OnConnect(cb func(s *Socket, namespace string)) {
@@ -286,6 +471,9 @@ func (s *Socket) OnceError(cb func(s *Socket, err error)) {
 	s.errorHandles.Once(cb)
 }
 
+// OnPacket registers a callback for received events, which is called after the payload codecs and the validator accepted the event.
+// The data of the packet is still encoded by the codecs.
+// The packet is reused after the callback returns and must not be modified, use Packet.Clone to retain it
 func (s *Socket) OnPacket(cb func(s *Socket, pkt *Packet)) {
 	s.packetHandlers.On(cb)
 }
@@ -302,6 +490,36 @@ func (s *Socket) OnceMessage(cb func(event string, args []any)) {
 	s.messageHandlers.Once(cb)
 }
 
+// OnMessageContext is like OnMessage, but the callback receives the socket's Context
+func (s *Socket) OnMessageContext(cb func(ctx context.Context, event string, args []any)) {
+	s.messageHandlers.On(func(event string, args []any) {
+		cb(s.Context(), event, args)
+	})
+}
+
+// OnPattern registers the callback for the events whose name matches the pattern,
+// the syntax is the same as path.Match, e.g. "user.*"
+func (s *Socket) OnPattern(pattern string, cb func(event string, args []any)) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	s.messageHandlers.On(func(event string, args []any) {
+		if ok, _ := path.Match(pattern, event); ok {
+			cb(event, args)
+		}
+	})
+	return nil
+}
+
+// OnRegexp registers the callback for the events whose name matches re
+func (s *Socket) OnRegexp(re *regexp.Regexp, cb func(event string, args []any)) {
+	s.messageHandlers.On(func(event string, args []any) {
+		if re.MatchString(event) {
+			cb(event, args)
+		}
+	})
+}
+
 func (s *Socket) Namespace() string {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
@@ -320,12 +538,13 @@ func (s *Socket) Close() (err error) {
 	if s.status.Load() == SocketClosed {
 		return
 	}
+	s.disconnectReason = engine.ReasonClientDisconnect
 
 	err = s.send(&Packet{
 		typ:       DISCONNECT,
 		namespace: s.namespace,
 	})
-	s.status.Store(SocketClosed)
+	s.disconnected()
 	return
 }
 
@@ -337,27 +556,83 @@ func (s *Socket) onEvent(pkt *Packet) {
 	if pkt.namespace != s.Namespace() {
 		return
 	}
-	s.packetHandlers.Call(s, pkt)
-	var arr []any
-	if err := pkt.UnmarshalData(&arr); err == nil {
-		if name, ok := arr[0].(string); ok {
-			s.messageHandlers.Call(name, arr[1:])
-		} else {
-			s.onError(errNotString)
-		}
-	} else {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(pkt.data, &raw); err != nil {
 		s.onError(err)
+		return
 	}
+	var name string
+	if len(raw) == 0 || json.Unmarshal(raw[0], &name) != nil {
+		s.onError(errNotString)
+		return
+	}
+	raw = raw[1:]
+	s.mux.Lock()
+	if s.pid != "" && len(raw) > 0 {
+		// the server appends the offset for the connection state recovery
+		var offset string
+		if json.Unmarshal(raw[len(raw)-1], &offset) == nil {
+			s.lastOffset = offset
+		}
+	}
+	s.mux.Unlock()
+
+	attachs := append(([][]byte)(nil), pkt.attachs...)
+	validator := s.validators[name]
+	// the values are only decoded from the raw arguments when the codecs or OnMessage need them
+	var args []any
+	if len(s.codecs) > 0 || s.messageHandlers.Len() > 0 {
+		var err error
+		if args, err = argValues(newArgs(raw, attachs)); err != nil {
+			s.onError(err)
+			return
+		}
+		if args, err = s.decodePayload(name, args); err != nil {
+			s.onError(err)
+			return
+		}
+		if len(s.codecs) > 0 && (validator != nil || s.rawMessageHandlers.Len() > 0 || s.eventHandlers.Len() > 0) {
+			raw = make([]json.RawMessage, len(args))
+			for i, a := range args {
+				if raw[i], err = json.Marshal(a); err != nil {
+					s.onError(&PayloadError{Event: name, Err: err})
+					return
+				}
+			}
+		}
+	}
+	if validator != nil {
+		if err := validator.Validate(name, newArgs(raw, attachs)); err != nil {
+			s.onError(&ValidationError{Event: name, Err: err})
+			return
+		}
+	}
+	// the packet is only dispatched after the codecs verified it
+	s.packetHandlers.Call(s, pkt)
+	if s.eventHandlers.Len() > 0 {
+		s.eventHandlers.Call(s, &receivedEvent{
+			namespace: pkt.namespace,
+			id:        pkt.Id(),
+			name:      name,
+			args:      newArgs(raw, attachs),
+			decoded:   args,
+		})
+	}
+	s.messageHandlers.Call(name, args)
+	s.rawMessageHandlers.Call(name, newArgs(raw, attachs))
 }
 
 func (s *Socket) onAck(pkt *Packet) {
 	s.ackMux.Lock()
-	id := pkt.Id()
-	ch, ok := s.ackChan[id]
-	delete(s.ackChan, id)
+	ack := s.takeAckLocked(pkt.Id())
 	s.ackMux.Unlock()
-	if ok {
+	if ack != nil {
+		ch := ack.ch
 		var arr []any
+		if len(pkt.data) == 0 {
+			ch <- nil
+			return
+		}
 		if err := pkt.UnmarshalData(&arr); err != nil {
 			s.onError(fmt.Errorf("socket.io: failed to unmarshal ack packet: %s,data: %v", err.Error(), string(pkt.data)))
 			return
@@ -388,7 +663,7 @@ func (s *Socket) onBinary(_ *engine.Socket, data []byte) {
 		case ACK, BINARY_ACK:
 			s.onAck(pkt)
 		default:
-			s.onError(&UnexpectedPacketTypeError{pkt.typ})
+			s.onError(&UnexpectedPacketTypeError{Type: pkt.typ})
 		}
 	}
 }
@@ -408,38 +683,16 @@ func (s *Socket) onMessage(_ *engine.Socket, data []byte) {
 	}
 	switch pkt.typ {
 	case CONNECT:
-		ok := s.Status() == SocketOpening && pkt.namespace == s.namespace
-		if !ok {
-			return
-		}
-		var obj struct {
-			Sid string `json:"sid"`
-			Pid string `json:"pid"`
-		}
-		if err := pkt.UnmarshalData(&obj); err != nil {
+		if s.legacy() && isRootNamespace(pkt.namespace) && s.Status() == SocketClosed {
+			// the v2 server connects the main namespace without waiting for Connect
+			s.mux.Lock()
+			s.autoConnected = true
+			s.mux.Unlock()
 			return
 		}
-		s.mux.Lock()
-		oldSid := s.sid
-		if true && len(s.msgbuf) == 0 { // TODO: socket.io retrive
-			s.ackId = 0
-		}
-		s.sid = obj.Sid
-		s.pid = obj.Pid
-		for i, bts := range s.msgbuf {
-			s.msgbuf[i] = nil
-			s.io.Emit(bts)
-		}
-		s.msgbuf = s.msgbuf[:0]
-		s.status.Store(SocketConnected)
-		s.mux.Unlock()
-
-		// If we already had a sid, this is a reconnect
-		if oldSid != "" && oldSid != obj.Sid {
-			s.reconnectHandles.Call(s, struct{}{})
-		}
-		s.connectHandles.Call(s, pkt.namespace)
+		s.onConnect(pkt)
 	case DISCONNECT:
+		s.setDisconnectReason(engine.ReasonServerDisconnect)
 		s.disconnected()
 		s.disconnectHandles.Call(s, pkt.namespace)
 	case EVENT, BINARY_EVENT:
@@ -453,37 +706,178 @@ func (s *Socket) onMessage(_ *engine.Socket, data []byte) {
 	case CONNECT_ERROR:
 		var reason string
 		if err := pkt.UnmarshalData(&reason); err != nil {
-			s.onError(err)
-			return
+			var obj struct {
+				Message string `json:"message"`
+			}
+			if pkt.UnmarshalData(&obj) != nil {
+				s.onError(err)
+				return
+			}
+			reason = obj.Message
 		}
 		s.onError(&ConnectError{reason})
 	default:
-		s.onError(&UnexpectedPacketTypeError{pkt.typ})
+		s.onError(&UnexpectedPacketTypeError{Type: pkt.typ})
+	}
+}
+
+func (s *Socket) onConnect(pkt *Packet) {
+	ok := s.Status() == SocketOpening && pkt.namespace == s.namespace
+	if !ok {
+		return
+	}
+	var obj struct {
+		Sid string `json:"sid"`
+		Pid string `json:"pid"`
+	}
+	if s.legacy() {
+		// the v2 server does not send the sid
+		obj.Sid = s.io.ID()
+		if !isRootNamespace(pkt.namespace) {
+			obj.Sid = pkt.namespace + "#" + obj.Sid
+		}
+	} else if err := pkt.UnmarshalData(&obj); err != nil {
+		return
+	}
+	s.mux.Lock()
+	s.ctxMux.Lock()
+	if s.ctx.Err() == nil {
+		// the buffered packets of a previous CONNECT are still being flushed
+		s.ctxMux.Unlock()
+		s.mux.Unlock()
+		return
+	}
+	s.ctxMux.Unlock()
+	oldSid := s.sid
+	s.recovered = obj.Pid != "" && obj.Pid == s.pid
+	if true && len(s.msgbuf) == 0 { // TODO: socket.io retrive
+		s.ackId = 0
+	}
+	s.sid = obj.Sid
+	s.pid = obj.Pid
+	s.ctxMux.Lock()
+	ioCtx := s.io.Context()
+	if ioCtx == nil {
+		ioCtx = context.Background()
+	}
+	s.ctx, s.cancel = context.WithCancelCause(ioCtx)
+	ctx := s.ctx
+	s.ctxMux.Unlock()
+	buffered := len(s.msgbuf) > 0
+	s.mux.Unlock()
+
+	namespace := pkt.namespace
+	finish := func() {
+		connected, errs := s.flush(ctx)
+		for _, err := range errs {
+			s.onError(err)
+		}
+		if !connected {
+			return
+		}
+		// If we already had a sid, this is a reconnect
+		if oldSid != "" && oldSid != obj.Sid {
+			s.reconnectHandles.Call(s, struct{}{})
+		}
+		s.connectHandles.Call(s, namespace)
+	}
+	if buffered {
+		// emitting may wait for the rate limit, which must not block the reader
+		go finish()
+	} else {
+		finish()
+	}
+}
+
+// flush sends the packets buffered before the namespace connected, and then marks the socket connected.
+// The lock is not held while emitting, since the send hooks may call back into the socket.
+// The status stays SocketOpening until the buffer is empty, so the packets emitted meanwhile are queued behind.
+// ctx is the context of the connection, the rest of the buffer is kept if it is canceled
+func (s *Socket) flush(ctx context.Context) (connected bool, errs []error) {
+	flushed := false
+	for {
+		s.mux.Lock()
+		if ctx.Err() != nil {
+			s.mux.Unlock()
+			return
+		}
+		pending := s.msgbuf
+		if len(pending) == 0 {
+			// the stored packets are kept until they were all sent, and flushed again after the next restart
+			if flushed && len(errs) == 0 && s.store != nil {
+				if err := s.store.Clear(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			connected = s.status.CompareAndSwap(SocketOpening, SocketConnected)
+			s.mux.Unlock()
+			return
+		}
+		s.msgbuf = nil
+		s.mux.Unlock()
+
+		flushed = true
+		for i, ep := range pending {
+			if ctx.Err() != nil {
+				// disconnected, the rest goes back in front of the packets buffered meanwhile
+				s.mux.Lock()
+				s.msgbuf = append(pending[i:len(pending):len(pending)], s.msgbuf...)
+				s.mux.Unlock()
+				return
+			}
+			if err := s.emitEncoded(ep); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 }
 
+// emitEncoded emits the packet and then its attachments as binary frames
+func (s *Socket) emitEncoded(ep encodedPacket) (err error) {
+	s.emitMux.Lock()
+	defer s.emitMux.Unlock()
+	if err = s.io.Emit(ep.text); err != nil {
+		return
+	}
+	for _, a := range ep.attachs {
+		if err = s.io.EmitBinary(a); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (s *Socket) send(pkt *Packet) (err error) {
 	var buf bytes.Buffer
 	if _, err = pkt.WriteTo(&buf); err != nil {
 		return
 	}
-	bts := buf.Bytes()
+	ep := encodedPacket{
+		text:    buf.Bytes(),
+		attachs: pkt.attachs,
+	}
 	if s.Status() == SocketConnected {
-		s.io.Emit(bts)
+		err = s.emitEncoded(ep)
 	} else {
 		switch pkt.typ {
 		case EVENT, BINARY_EVENT, ACK, BINARY_ACK:
 			s.mux.Lock()
 			if s.Status() == SocketConnected {
 				s.mux.Unlock()
-				s.io.Emit(bts)
+				err = s.emitEncoded(ep)
 			} else {
-				s.msgbuf = append(s.msgbuf, bts)
+				s.msgbuf = append(s.msgbuf, ep)
+				if s.store != nil {
+					err = s.store.Append(StoredPacket{
+						Text:        ep.text,
+						Attachments: ep.attachs,
+					})
+				}
 				s.mux.Unlock()
 			}
 		default:
 			if s.io.Connected() {
-				s.io.Emit(bts)
+				err = s.emitEncoded(ep)
 			}
 		}
 	}
@@ -491,7 +885,28 @@ func (s *Socket) send(pkt *Packet) (err error) {
 }
 
 func (s *Socket) Emit(event string, args ...any) (err error) {
-	pkt := Packet{
+	pkt, err := s.eventPacket(event, args, false)
+	if err != nil || pkt == nil {
+		return
+	}
+	return s.send(pkt)
+}
+
+// eventPacket encodes the event and its arguments into an EVENT packet,
+// it returns a nil packet if a middleware dropped the event
+func (s *Socket) eventPacket(event string, args []any, ack bool) (pkt *Packet, err error) {
+	var e OutgoingEvent
+	if e, err = s.outgoing.run(s, OutgoingEvent{Event: event, Args: args, Ack: ack}); err != nil {
+		if err == ErrDropEvent && !ack {
+			return nil, nil
+		}
+		return nil, &MiddlewareError{Event: event, Err: err}
+	}
+	event, args = e.Event, e.Args
+	if args, err = s.encodePayload(event, args); err != nil {
+		return
+	}
+	pkt = &Packet{
 		typ:       EVENT,
 		namespace: s.namespace,
 	}
@@ -499,14 +914,15 @@ func (s *Socket) Emit(event string, args ...any) (err error) {
 	argsAll[0] = event
 	copy(argsAll[1:], args)
 	if err = pkt.SetData(argsAll...); err != nil {
-		return
+		return nil, err
 	}
-	return s.send(&pkt)
+	return
 }
 
-func (s *Socket) assignAckId() (id int, res <-chan []any) {
+func (s *Socket) assignAckId(event string, timeout time.Duration) (ack *pendingAck) {
 	s.ackMux.Lock()
 	defer s.ackMux.Unlock()
+	var id int
 	for {
 		id = s.ackId
 		s.ackId = (s.ackId + 1) & 0x3fffffff
@@ -514,32 +930,89 @@ func (s *Socket) assignAckId() (id int, res <-chan []any) {
 			break
 		}
 	}
-	ch := make(chan []any, 1)
-	s.ackChan[id] = ch
-	res = ch
+	ack = &pendingAck{
+		id:      id,
+		event:   event,
+		timeout: timeout,
+		ch:      make(chan []any, 1),
+	}
+	s.ackChan[id] = ack
 	return
 }
 
+// releaseWindow frees the window slot held by the ack id, ackMux must be held
+func (s *Socket) releaseWindow(id int) {
+	if _, ok := s.windowIds[id]; ok {
+		delete(s.windowIds, id)
+		<-s.window
+	}
+}
+
+// acquireWindow blocks until there is a free slot in the send window,
+// ctx is done, or the socket disconnected from the namespace
+func (s *Socket) acquireWindow(ctx context.Context) error {
+	select {
+	case s.window <- struct{}{}:
+		return nil
+	default:
+	}
+	sctx := s.Context()
+	select {
+	case s.window <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-sctx.Done():
+		return context.Cause(sctx)
+	}
+}
+
+// EmitWithAck sends the event and returns a channel which receives the ack arguments.
+// If a send window is set, it blocks until there is a free slot.
+// If the ack did not arrive within the timeout set by WithAckTimeout, or the socket disconnected before it,
+// the channel is closed without a value. Use EmitWithAckContext to get the cause
 func (s *Socket) EmitWithAck(event string, args ...any) (<-chan []any, error) {
-	pkt := &Packet{
-		typ:       EVENT,
-		namespace: s.namespace,
+	return s.Timeout(s.ackTimeout).EmitWithAck(event, args...)
+}
+
+func (s *Socket) emitWithAck(ctx context.Context, event string, args []any, timeout time.Duration) (ack *pendingAck, err error) {
+	pkt, err := s.eventPacket(event, args, true)
+	if err != nil {
+		return
 	}
-	argsAll := make([]any, 1+len(args))
-	argsAll[0] = event
-	copy(argsAll[1:], args)
-	if err := pkt.SetData(argsAll...); err != nil {
-		return nil, err
+	if s.window != nil {
+		if err = s.acquireWindow(ctx); err != nil {
+			return
+		}
 	}
-	id, res := s.assignAckId()
-	pkt.SetId(id)
-	if err := s.send(pkt); err != nil {
+	ack = s.assignAckId(event, timeout)
+	if s.window != nil {
 		s.ackMux.Lock()
-		delete(s.ackChan, id)
+		s.windowIds[ack.id] = struct{}{}
 		s.ackMux.Unlock()
+	}
+	pkt.SetId(ack.id)
+	if err = s.send(pkt); err != nil {
+		s.cancelAck(ack.id)
 		return nil, err
 	}
-	return res, nil
+	if timeout > 0 {
+		s.ackMux.Lock()
+		if s.ackChan[ack.id] == ack {
+			ack.timer = time.AfterFunc(timeout, func() {
+				s.expireAck(ack)
+			})
+		}
+		s.ackMux.Unlock()
+	}
+	return
+}
+
+// cancelAck stops waiting for the ack
+func (s *Socket) cancelAck(id int) {
+	s.ackMux.Lock()
+	s.takeAckLocked(id)
+	s.ackMux.Unlock()
 }
 
 // ReConnect attempts to reconnect to the server with the same namespace.
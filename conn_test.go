@@ -0,0 +1,138 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket_test
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	socket "github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/ahollic/socket.io/socketiotest"
+)
+
+func TestFlushCallsBackIntoSocket(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	io, err := engine.NewSocket(srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer io.Close()
+	s := socket.NewSocket(io)
+	var calls atomic.Int32
+	io.OnSend(func(_ *engine.Socket, data []byte) {
+		// the hook must not deadlock while the buffered packets are flushed
+		if bytes.Contains(data, []byte("first")) || bytes.Contains(data, []byte("second")) {
+			s.ID()
+			calls.Add(1)
+		}
+	})
+	for _, name := range []string{"first", "second"} {
+		if err := s.Emit(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := io.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Accept(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ConnectAndWait(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if _, err := srv.WaitEvent(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("the send hook was called for %d buffered events, want 2", n)
+	}
+}
+
+func TestFlushDoesNotBlockReader(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := srv.Options()
+	// the CONNECT packet takes the burst, each buffered event then waits half a second
+	opts.RateLimit = &engine.RateLimit{
+		Packets:     2,
+		PacketBurst: 1,
+		Policy:      engine.RateLimitWait,
+	}
+	io, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer io.Close()
+	s := socket.NewSocket(io)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := s.Emit(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, stop := s.Events(1)
+	defer stop()
+	if err := io.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Connect(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.WaitEvent(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := c.Emit("/", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Name != "hello" {
+			t.Fatalf("received %q, want %q", ev.Name, "hello")
+		}
+	case <-ctx.Done():
+		t.Fatal("no event received")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("the event was received after %s, the reader waited for the flush", d)
+	}
+	if err := s.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.WaitEvent(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,205 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package emitter
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultKey is the channel prefix used by the socket.io redis adapter
+const DefaultKey = "socket.io"
+
+// uid identifies the publisher, the adapter ignores messages sent by itself with the same uid
+const uid = "emitter"
+
+// packetTypeEvent is the Socket.IO EVENT packet type
+const packetTypeEvent = 2
+
+var reservedEvents = map[string]struct{}{
+	"connect":        {},
+	"connect_error":  {},
+	"disconnect":     {},
+	"disconnecting":  {},
+	"newListener":    {},
+	"removeListener": {},
+}
+
+// Publisher publishes a message to a pub/sub channel, usually backed by a redis client
+type Publisher interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+}
+
+type ReservedEventError struct {
+	Event string
+}
+
+var _ error = (*ReservedEventError)(nil)
+
+func (e *ReservedEventError) Error() string {
+	return fmt.Sprintf("Socket.IO: %q is a reserved event name", e.Event)
+}
+
+// Emitter builds a broadcast and publishes it to the adapter channel.
+// Operator methods return a new Emitter, so an Emitter can be shared and reused
+type Emitter struct {
+	pub      Publisher
+	key      string
+	nsp      string
+	rooms    []string
+	except   []string
+	volatile bool
+	compress *bool
+}
+
+// New creates an Emitter for the main namespace,
+// key is the adapter channel prefix, if empty DefaultKey will be used
+func New(pub Publisher, key string) *Emitter {
+	if key == "" {
+		key = DefaultKey
+	}
+	return &Emitter{
+		pub: pub,
+		key: key,
+		nsp: "/",
+	}
+}
+
+func (e *Emitter) clone() *Emitter {
+	e2 := *e
+	e2.rooms = append(([]string)(nil), e.rooms...)
+	e2.except = append(([]string)(nil), e.except...)
+	return &e2
+}
+
+// Of returns an Emitter for the namespace
+func (e *Emitter) Of(nsp string) *Emitter {
+	if len(nsp) == 0 || nsp[0] != '/' {
+		nsp = "/" + nsp
+	}
+	e2 := e.clone()
+	e2.nsp = nsp
+	e2.rooms = nil
+	e2.except = nil
+	return e2
+}
+
+// To targets the rooms, can be called multiple times
+func (e *Emitter) To(rooms ...string) *Emitter {
+	e2 := e.clone()
+	for _, r := range rooms {
+		if !contains(e2.rooms, r) {
+			e2.rooms = append(e2.rooms, r)
+		}
+	}
+	return e2
+}
+
+// In is an alias of To
+func (e *Emitter) In(rooms ...string) *Emitter {
+	return e.To(rooms...)
+}
+
+// Except excludes the sockets in the rooms
+func (e *Emitter) Except(rooms ...string) *Emitter {
+	e2 := e.clone()
+	for _, r := range rooms {
+		if !contains(e2.except, r) {
+			e2.except = append(e2.except, r)
+		}
+	}
+	return e2
+}
+
+// Volatile marks the event as droppable if the client is not ready to receive it
+func (e *Emitter) Volatile() *Emitter {
+	e2 := e.clone()
+	e2.volatile = true
+	return e2
+}
+
+// Compress sets the compress flag of the event
+func (e *Emitter) Compress(compress bool) *Emitter {
+	e2 := e.clone()
+	e2.compress = &compress
+	return e2
+}
+
+// Emit publishes the event to all targeted sockets.
+// Arguments of type []byte are sent as binary, other arguments must be JSON serializable
+func (e *Emitter) Emit(ctx context.Context, event string, args ...any) (err error) {
+	if _, ok := reservedEvents[event]; ok {
+		return &ReservedEventError{event}
+	}
+	data := make([]any, 0, 1+len(args))
+	data = append(data, event)
+	data = append(data, args...)
+
+	flags := make(map[string]any, 2)
+	if e.volatile {
+		flags["volatile"] = true
+	}
+	if e.compress != nil {
+		flags["compress"] = *e.compress
+	}
+
+	msg, err := marshalMsgpack([]any{
+		uid,
+		map[string]any{
+			"type": packetTypeEvent,
+			"data": data,
+			"nsp":  e.nsp,
+		},
+		map[string]any{
+			"rooms":  stringsToAny(e.rooms),
+			"except": stringsToAny(e.except),
+			"flags":  flags,
+		},
+	})
+	if err != nil {
+		return
+	}
+	return e.pub.Publish(ctx, e.channel(), msg)
+}
+
+func (e *Emitter) channel() string {
+	ch := e.key + "#" + e.nsp + "#"
+	if len(e.rooms) == 1 {
+		ch += e.rooms[0] + "#"
+	}
+	return ch
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func stringsToAny(list []string) []any {
+	res := make([]any, len(list))
+	for i, v := range list {
+		res[i] = v
+	}
+	return res
+}
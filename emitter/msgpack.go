@@ -0,0 +1,226 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package emitter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// marshalMsgpack encodes v in the MessagePack format used by the socket.io adapters.
+// Values other than the basic types are converted through encoding/json first
+func marshalMsgpack(v any) (data []byte, err error) {
+	var buf bytes.Buffer
+	if err = writeMsgpack(&buf, v); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMsgpack(buf *bytes.Buffer, v any) (err error) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int:
+		writeInt(buf, (int64)(v))
+	case int8:
+		writeInt(buf, (int64)(v))
+	case int16:
+		writeInt(buf, (int64)(v))
+	case int32:
+		writeInt(buf, (int64)(v))
+	case int64:
+		writeInt(buf, v)
+	case uint:
+		writeUint(buf, (uint64)(v))
+	case uint8:
+		writeUint(buf, (uint64)(v))
+	case uint16:
+		writeUint(buf, (uint64)(v))
+	case uint32:
+		writeUint(buf, (uint64)(v))
+	case uint64:
+		writeUint(buf, v)
+	case float32:
+		buf.WriteByte(0xca)
+		buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(v)))
+	case float64:
+		writeFloat(buf, v)
+	case json.Number:
+		if n, e := v.Int64(); e == nil {
+			writeInt(buf, n)
+		} else {
+			f, e := v.Float64()
+			if e != nil {
+				return e
+			}
+			writeFloat(buf, f)
+		}
+	case string:
+		writeString(buf, v)
+	case []byte:
+		writeBin(buf, v)
+	case json.RawMessage:
+		var val any
+		if err = decodeJSON(v, &val); err != nil {
+			return
+		}
+		return writeMsgpack(buf, val)
+	case []any:
+		writeHeader(buf, len(v), 0x90, 0x0f, 0xdc, 0xdd)
+		for _, e := range v {
+			if err = writeMsgpack(buf, e); err != nil {
+				return
+			}
+		}
+	case map[string]any:
+		writeHeader(buf, len(v), 0x80, 0x0f, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeString(buf, k)
+			if err = writeMsgpack(buf, v[k]); err != nil {
+				return
+			}
+		}
+	default:
+		var bts []byte
+		if bts, err = json.Marshal(v); err != nil {
+			return
+		}
+		var val any
+		if err = decodeJSON(bts, &val); err != nil {
+			return
+		}
+		return writeMsgpack(buf, val)
+	}
+	return
+}
+
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func writeInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0:
+		writeUint(buf, (uint64)(n))
+	case n >= -32:
+		buf.WriteByte((byte)(n))
+	case n >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte((byte)(n))
+	case n >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, (uint16)(n)))
+	case n >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, (uint32)(n)))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, (uint64)(n)))
+	}
+}
+
+func writeUint(buf *bytes.Buffer, n uint64) {
+	switch {
+	case n <= 0x7f:
+		buf.WriteByte((byte)(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte((byte)(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		buf.Write(binary.BigEndian.AppendUint16(nil, (uint16)(n)))
+	case n <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		buf.Write(binary.BigEndian.AppendUint32(nil, (uint32)(n)))
+	default:
+		buf.WriteByte(0xcf)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func writeFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(0xcb)
+	buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf.WriteByte(0xa0 | (byte)(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte((byte)(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		buf.Write(binary.BigEndian.AppendUint16(nil, (uint16)(n)))
+	default:
+		buf.WriteByte(0xdb)
+		buf.Write(binary.BigEndian.AppendUint32(nil, (uint32)(n)))
+	}
+	buf.WriteString(s)
+}
+
+func writeBin(buf *bytes.Buffer, b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte((byte)(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		buf.Write(binary.BigEndian.AppendUint16(nil, (uint16)(n)))
+	default:
+		buf.WriteByte(0xc6)
+		buf.Write(binary.BigEndian.AppendUint32(nil, (uint32)(n)))
+	}
+	buf.Write(b)
+}
+
+// writeHeader writes an array or map header
+func writeHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, op16, op32 byte) {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(fix | (byte)(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(op16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, (uint16)(n)))
+	default:
+		buf.WriteByte(op32)
+		buf.Write(binary.BigEndian.AppendUint32(nil, (uint32)(n)))
+	}
+}
@@ -0,0 +1,116 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+type Direction string
+
+const (
+	Recv Direction = "recv"
+	Send Direction = "send"
+)
+
+// Record is a captured frame, encoded as one JSON line
+type Record struct {
+	Time time.Time `json:"time"`
+	Dir  Direction `json:"dir"`
+	// Text is the encoded packet of a text frame
+	Text string `json:"text,omitempty"`
+	// Binary is the payload of a binary frame
+	Binary []byte `json:"binary,omitempty"`
+}
+
+func (r *Record) IsBinary() bool {
+	return r.Binary != nil
+}
+
+// Recorder writes the frames of attached sockets to a writer
+type Recorder struct {
+	mux sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Attach starts recording frames sent and received by the socket
+func (r *Recorder) Attach(s *engine.Socket) {
+	s.OnRecvFrame(func(_ *engine.Socket, f engine.Frame) {
+		r.write(newRecord(Recv, f))
+	})
+	s.OnSendFrame(func(_ *engine.Socket, f engine.Frame) {
+		r.write(newRecord(Send, f))
+	})
+}
+
+func newRecord(dir Direction, f engine.Frame) Record {
+	if f.Binary {
+		return Record{Time: f.Time, Dir: dir, Binary: append(make([]byte, 0, len(f.Data)), f.Data...)}
+	}
+	return Record{Time: f.Time, Dir: dir, Text: (string)(f.Data)}
+}
+
+func (r *Recorder) write(rec Record) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(rec)
+}
+
+// Err returns the first error occurred when writing records
+func (r *Recorder) Err() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.err
+}
+
+// Load reads all records written by a Recorder
+func Load(r io.Reader) (records []Record, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<26)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return
+		}
+		records = append(records, rec)
+	}
+	err = sc.Err()
+	return
+}
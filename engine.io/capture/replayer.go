@@ -0,0 +1,139 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package capture
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+const ReplayTransport = "replay"
+
+// Replayer is an engine.Transport that feeds the received frames of a record
+// into the dialing socket. Frames written by the socket are collected and can be
+// inspected by Sent
+type Replayer struct {
+	// RealTime keeps the recorded intervals between the frames
+	RealTime bool
+
+	records []Record
+
+	mux  sync.Mutex
+	sent [][]byte
+}
+
+var _ engine.Transport = (*Replayer)(nil)
+
+func NewReplayer(records []Record) *Replayer {
+	return &Replayer{
+		records: records,
+	}
+}
+
+func (r *Replayer) Name() string {
+	return ReplayTransport
+}
+
+// Options returns engine options that dial through this replayer only
+func (r *Replayer) Options() engine.Options {
+	return engine.Options{
+		Host:       ReplayTransport,
+		Path:       "/engine.io/",
+		Transports: []string{ReplayTransport},
+		CustomTransports: map[string]engine.Transport{
+			ReplayTransport: r,
+		},
+	}
+}
+
+func (r *Replayer) Dial(ctx context.Context, _ *engine.Socket, _ *url.URL) (engine.Conn, error) {
+	c := &replayConn{
+		r:      r,
+		closed: make(chan struct{}),
+	}
+	for _, rec := range r.records {
+		if rec.Dir == Recv {
+			c.records = append(c.records, rec)
+		}
+	}
+	return c, nil
+}
+
+// Sent returns the text frames have been written to the replayer
+func (r *Replayer) Sent() [][]byte {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append(([][]byte)(nil), r.sent...)
+}
+
+type replayConn struct {
+	r       *Replayer
+	records []Record
+	last    time.Time
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+var _ engine.Conn = (*replayConn)(nil)
+
+func (c *replayConn) ReadFrame(buf []byte) (binary bool, data []byte, err error) {
+	if len(c.records) == 0 {
+		return false, buf[:0], io.EOF
+	}
+	rec := c.records[0]
+	c.records = c.records[1:]
+	if c.r.RealTime && !c.last.IsZero() {
+		timer := time.NewTimer(rec.Time.Sub(c.last))
+		select {
+		case <-timer.C:
+		case <-c.closed:
+			timer.Stop()
+			return false, buf[:0], io.ErrClosedPipe
+		}
+	}
+	c.last = rec.Time
+	if rec.IsBinary() {
+		return true, append(buf[:0], rec.Binary...), nil
+	}
+	return false, append(buf[:0], rec.Text...), nil
+}
+
+func (c *replayConn) WriteFrame(binary bool, data []byte) error {
+	if binary {
+		return nil
+	}
+	c.r.mux.Lock()
+	defer c.r.mux.Unlock()
+	c.r.sent = append(c.r.sent, append(make([]byte, 0, len(data)), data...))
+	return nil
+}
+
+func (c *replayConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
@@ -0,0 +1,48 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"github.com/ahollic/socket.io/internal/utils"
+)
+
+// Messages returns a channel which receives the MESSAGE packets, size is the buffer size of the channel.
+// The reader blocks while the channel is full, so the channel must be drained.
+// stop unregisters and closes the channel, it must not be called from a callback of the socket
+func (s *Socket) Messages(size int) (messages <-chan []byte, stop func()) {
+	c := utils.NewChan[[]byte](size)
+	cancel := s.messageHandles.On(func(_ *Socket, data []byte) {
+		if s.opts.ZeroCopy {
+			data = append(([]byte)(nil), data...)
+		}
+		c.Send(data)
+	})
+	return c.C(), func() { c.Stop(cancel) }
+}
+
+// StateChanges returns a channel which receives the state transitions,
+// it works the same way as Messages
+func (s *Socket) StateChanges(size int) (changes <-chan StateChange, stop func()) {
+	c := utils.NewChan[StateChange](size)
+	cancel := s.stateHandles.On(func(_ *Socket, change StateChange) {
+		c.Send(change)
+	})
+	return c.C(), func() { c.Stop(cancel) }
+}
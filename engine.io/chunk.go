@@ -0,0 +1,211 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+type PayloadPolicy int
+
+const (
+	// PayloadAllow sends the packets regardless of their size
+	PayloadAllow PayloadPolicy = iota
+	// PayloadReject makes Emit return *PayloadTooLargeError for packets larger than maxPayload
+	PayloadReject
+	// PayloadChunk splits messages larger than maxPayload into chunks.
+	// The peer must reassemble them, which is done automatically when it's also using PayloadChunk.
+	//
+	// A chunk is a MESSAGE packet with body "\x1f<seq>,<index>,<total>,<data>",
+	// seq identifies the message, and data is the index-th part of the original body,
+	// parts are split at UTF-8 rune boundaries
+	PayloadChunk
+)
+
+// chunkMarker starts the body of a chunk packet, a Socket.IO packet will never start with it
+const chunkMarker = '\x1f'
+
+const (
+	// defaultChunkedLimit is the maximum size of a reassembled message when ReadLimit is not positive
+	defaultChunkedLimit = 64 << 20
+	// maxPendingChunked is the maximum number of partially received messages,
+	// the oldest one is dropped when a new message starts
+	maxPendingChunked = 16
+	// chunkTimeout is the time after which a partially received message is dropped
+	chunkTimeout = time.Minute
+)
+
+type PayloadTooLargeError struct {
+	Size       int
+	MaxPayload int
+}
+
+var _ error = (*PayloadTooLargeError)(nil)
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("Engine.IO: packet size %d exceeds maxPayload %d", e.Size, e.MaxPayload)
+}
+
+type chunkedMessage struct {
+	parts   map[int][]byte
+	total   int
+	size    int64
+	started time.Time
+}
+
+// splitChunks splits body into chunk bodies which are not larger than size-1
+func splitChunks(seq uint64, body []byte, size int) (chunks [][]byte, err error) {
+	// packet type, marker, seq, 3 commas, index and total which have at most 10 digits
+	overhead := 2 + len(strconv.FormatUint(seq, 10)) + 3 + 2*10
+	partSize := size - overhead
+	if partSize <= utf8.UTFMax {
+		return nil, &PayloadTooLargeError{Size: len(body) + 1, MaxPayload: size}
+	}
+	var parts [][]byte
+	for rest := body; len(rest) > 0; {
+		n := partSize
+		if n >= len(rest) {
+			n = len(rest)
+		} else {
+			for n > 0 && !utf8.RuneStart(rest[n]) {
+				n--
+			}
+		}
+		parts = append(parts, rest[:n])
+		rest = rest[n:]
+	}
+	chunks = make([][]byte, len(parts))
+	for i, part := range parts {
+		buf := make([]byte, 0, overhead+len(part))
+		buf = append(buf, chunkMarker)
+		buf = strconv.AppendUint(buf, seq, 10)
+		buf = append(buf, ',')
+		buf = strconv.AppendInt(buf, (int64)(i), 10)
+		buf = append(buf, ',')
+		buf = strconv.AppendInt(buf, (int64)(len(parts)), 10)
+		buf = append(buf, ',')
+		chunks[i] = append(buf, part...)
+	}
+	return
+}
+
+// parseChunk parses the header of a chunk body
+func parseChunk(body []byte) (seq uint64, index, total int, data []byte, ok bool) {
+	if len(body) == 0 || body[0] != chunkMarker {
+		return
+	}
+	fields := bytes.SplitN(body[1:], []byte{','}, 4)
+	if len(fields) != 4 {
+		return
+	}
+	var err error
+	if seq, err = strconv.ParseUint((string)(fields[0]), 10, 64); err != nil {
+		return
+	}
+	if index, err = strconv.Atoi((string)(fields[1])); err != nil {
+		return
+	}
+	if total, err = strconv.Atoi((string)(fields[2])); err != nil || index < 0 || index >= total {
+		return
+	}
+	return seq, index, total, fields[3], true
+}
+
+// chunkedLimit returns the maximum size of a reassembled message
+func (s *Socket) chunkedLimit() int64 {
+	if s.opts.ReadLimit > 0 {
+		return s.opts.ReadLimit
+	}
+	return defaultChunkedLimit
+}
+
+// onChunk stores the chunk, and returns the reassembled body once all chunks are received.
+// Chunks of a message larger than the limit are reported as *ProtocolError.
+// It should only be called by the reader goroutine
+func (s *Socket) onChunk(body []byte) (full []byte, done bool, err error) {
+	seq, index, total, data, ok := parseChunk(body)
+	if !ok {
+		return body, true, nil
+	}
+	limit := s.chunkedLimit()
+	// every chunk except the last one is at least as large as this one
+	if index < total-1 && (int64)(total-1) > limit/(int64)(max(len(data), 1)) {
+		return nil, false, &ProtocolError{fmt.Sprintf("chunked message with %d parts of %d bytes exceeds the limit %d", total, len(data), limit)}
+	}
+	now := time.Now()
+	if s.chunks == nil {
+		s.chunks = make(map[uint64]*chunkedMessage)
+	}
+	msg, ok := s.chunks[seq]
+	if !ok {
+		s.evictChunks(now)
+		msg = &chunkedMessage{
+			parts:   make(map[int][]byte),
+			total:   total,
+			started: now,
+		}
+		s.chunks[seq] = msg
+	}
+	if msg.total != total {
+		return
+	}
+	if _, ok := msg.parts[index]; ok {
+		return
+	}
+	if msg.size += (int64)(len(data)); msg.size > limit {
+		delete(s.chunks, seq)
+		return nil, false, &ProtocolError{fmt.Sprintf("chunked message exceeds the limit %d", limit)}
+	}
+	msg.parts[index] = append(make([]byte, 0, len(data)), data...)
+	if len(msg.parts) < total {
+		return
+	}
+	delete(s.chunks, seq)
+	full = make([]byte, 0, msg.size)
+	for i := 0; i < total; i++ {
+		full = append(full, msg.parts[i]...)
+	}
+	return full, true, nil
+}
+
+// evictChunks drops the expired messages, and the oldest ones if there are too many
+func (s *Socket) evictChunks(now time.Time) {
+	for seq, msg := range s.chunks {
+		if now.Sub(msg.started) > chunkTimeout {
+			delete(s.chunks, seq)
+		}
+	}
+	for len(s.chunks) >= maxPendingChunked {
+		var (
+			oldest    uint64
+			oldestMsg *chunkedMessage
+		)
+		for seq, msg := range s.chunks {
+			if oldestMsg == nil || msg.started.Before(oldestMsg.started) {
+				oldest, oldestMsg = seq, msg
+			}
+		}
+		delete(s.chunks, oldest)
+	}
+}
@@ -0,0 +1,111 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/ahollic/socket.io/engine.io/enginetest"
+)
+
+func TestChunkReassembly(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.PayloadPolicy = engine.PayloadChunk
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	messages, stop := s.Messages(4)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := connect(t, ctx, p, s)
+
+	for _, chunk := range []string{
+		// the chunks of message 1 arrive out of order
+		"\x1f1,2,3,ghi", "\x1f1,0,3,abc",
+		// message 2 misses its last chunk and must never be delivered
+		"\x1f2,0,2,lost",
+		"\x1f1,1,3,def",
+		// a duplicate chunk of a completed message starts a new incomplete one
+		"\x1f1,1,3,def",
+		"\x1f3,0,1,single",
+	} {
+		if err := c.SendMessage([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"abcdefghi", "single"} {
+		select {
+		case msg := <-messages:
+			if string(msg) != want {
+				t.Fatalf("received %q, want %q", msg, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("message %q was not reassembled", want)
+		}
+	}
+	if err := c.SendMessage([]byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-messages:
+		if string(msg) != "plain" {
+			t.Fatalf("received %q after the incomplete messages, want %q", msg, "plain")
+		}
+	case <-ctx.Done():
+		t.Fatal("no message received")
+	}
+}
+
+func TestChunkLimit(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.PayloadPolicy = engine.PayloadChunk
+	opts.ReadLimit = 8
+	opts.DisableReconnection = true
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := connect(t, ctx, p, s)
+
+	for _, chunk := range []string{"\x1f1,0,3,abcd", "\x1f1,1,3,efgh", "\x1f1,2,3,ijk"} {
+		if err := c.SendMessage([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.WaitClosed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var pe *engine.ProtocolError
+	if err := s.CloseReason(); !errors.As(err, &pe) {
+		t.Fatalf("closed with %v, want *ProtocolError", err)
+	}
+}
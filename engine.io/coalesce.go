@@ -0,0 +1,118 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// coalesceMaxSize is the size of buffered writes which will be flushed immediately
+const coalesceMaxSize = 64 * 1024
+
+// coalescingConn buffers the writes to the connection and flushes them after interval,
+// so the websocket frames written within the interval are sent by a single syscall
+type coalescingConn struct {
+	net.Conn
+	interval time.Duration
+
+	mux     sync.Mutex
+	buf     []byte
+	timer   *time.Timer
+	pending bool
+	err     error
+}
+
+func coalesceDialFunc(dial func(ctx context.Context, network, addr string) (net.Conn, error), interval time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &coalescingConn{Conn: conn, interval: interval}, nil
+	}
+}
+
+func (c *coalescingConn) Write(p []byte) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= coalesceMaxSize {
+		return len(p), c.flushLocked()
+	}
+	if !c.pending {
+		c.pending = true
+		if c.timer == nil {
+			c.timer = time.AfterFunc(c.interval, c.flush)
+		} else {
+			c.timer.Reset(c.interval)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *coalescingConn) flush() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.flushLocked()
+}
+
+func (c *coalescingConn) flushLocked() error {
+	c.pending = false
+	if c.err != nil || len(c.buf) == 0 {
+		return c.err
+	}
+	_, c.err = c.Conn.Write(c.buf)
+	if cap(c.buf) > coalesceMaxSize*2 {
+		c.buf = nil
+	} else {
+		c.buf = c.buf[:0]
+	}
+	return c.err
+}
+
+// Read flushes the buffered writes first, since a response may be expected, e.g. during the handshake
+func (c *coalescingConn) Read(p []byte) (int, error) {
+	c.mux.Lock()
+	pending := c.pending
+	c.mux.Unlock()
+	if pending {
+		c.flush()
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *coalescingConn) Close() error {
+	c.mux.Lock()
+	c.flushLocked()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mux.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,104 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// BinaryCompression gzips the large binary bodies.
+// Each binary body is prefixed with a flag byte which tells whether it's compressed,
+// so the peer must enable BinaryCompression as well.
+// Text packets can be compressed by the websocket permessage-deflate extension, see Options.WebsocketDialer
+type BinaryCompression struct {
+	// MinSize is the size from which the bodies are compressed, default is 1024
+	MinSize int
+	// Level is the gzip compression level, zero means gzip.DefaultCompression
+	Level int
+	// MaxSize limits the size of the decompressed bodies, default is 16 MiB
+	MaxSize int64
+}
+
+const (
+	binaryFlagRaw  byte = 0
+	binaryFlagGzip byte = 1
+)
+
+func (c *BinaryCompression) encode(data []byte) ([]byte, error) {
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = 1024
+	}
+	if len(data) < minSize {
+		return append([]byte{binaryFlagRaw}, data...), nil
+	}
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(binaryFlagGzip)
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > len(data) {
+		// not compressible
+		return append([]byte{binaryFlagRaw}, data...), nil
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *BinaryCompression) decode(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, &ProtocolError{"binary body is missing the compression flag"}
+	}
+	switch data[0] {
+	case binaryFlagRaw:
+		return data[1:], nil
+	case binaryFlagGzip:
+	default:
+		return nil, &ProtocolError{"unknown binary compression flag"}
+	}
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = 16 << 20
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, &ProtocolError{"invalid compressed binary body: " + err.Error()}
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, &ProtocolError{"invalid compressed binary body: " + err.Error()}
+	}
+	if (int64)(len(out)) > maxSize {
+		return nil, &ReadLimitError{Limit: maxSize}
+	}
+	return out, nil
+}
@@ -23,13 +23,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ahollic/socket.io/internal/utils"
 	"github.com/gorilla/websocket"
@@ -37,19 +42,27 @@ import (
 
 const Protocol = 4
 
+// ProtocolV3 is the legacy Engine.IO protocol used by Socket.IO v2 servers,
+// in which the client sends the PING packets
+const ProtocolV3 = 3
+
 var (
 	errMultipleOpen = errors.New("Engine.IO: socket was already opened")
 
 	ErrSocketConnected = errors.New("Engine.IO: socket was already connected")
+	ErrNotConnected    = errors.New("Engine.IO: socket is not connected")
 	ErrPingTimeout     = errors.New("Engine.IO: did not receive PING packet for a long time")
 )
 
+// SocketStatus is the coarse status of a socket, see State for the detailed one
 type SocketStatus = int32
 
 const (
 	SocketClosed SocketStatus = iota
 	SocketOpening
 	SocketConnected
+	// SocketFailed means the socket gave up reconnecting, see Options.MaxReconnectAttempts
+	SocketFailed
 )
 
 var WebsocketDialer *websocket.Dialer = &websocket.Dialer{
@@ -67,28 +80,81 @@ type Socket struct {
 	ctx     context.Context
 	cancel  context.CancelCauseFunc
 
+	openHandles       utils.HandlerList[*Socket, []byte]
 	connectHandles    utils.HandlerList[*Socket, struct{}]
 	disconnectHandles utils.HandlerList[*Socket, error]
 	dialErrorHandles  utils.HandlerList[*Socket, *DialErrorContext]
-	reconnectHandles  utils.HandlerList[*Socket, struct{}]
-	pongHandles       utils.HandlerList[*Socket, []byte]
-	binaryHandlers    utils.HandlerList[*Socket, []byte]
-	messageHandles    utils.HandlerList[*Socket, []byte]
+	attemptHandles    utils.HandlerList[*Socket, *ReconnectAttempt]
+
+	reconnectFailedHandles utils.HandlerList[*Socket, struct{}]
+	reconnectHandles       utils.HandlerList[*Socket, struct{}]
+	pongHandles            utils.HandlerList[*Socket, []byte]
+	unknownHandles         utils.HandlerList[*Socket, []byte]
+
+	pingExpectedHandles utils.HandlerList[*Socket, struct{}]
+	pingMissedHandles   utils.HandlerList[*Socket, struct{}]
+	binaryHandlers      utils.HandlerList[*Socket, Binary]
+	messageHandles      utils.HandlerList[*Socket, []byte]
 	// debug handler
 	recvHandles utils.HandlerList[*Socket, []byte]
 	sendHandles utils.HandlerList[*Socket, []byte]
 
-	wsconn         *websocket.Conn
+	recvFrameHandles utils.HandlerList[*Socket, Frame]
+	sendFrameHandles utils.HandlerList[*Socket, Frame]
+	recvInterceptors interceptorChain
+	tracer           atomic.Pointer[log.Logger]
+	sendInterceptors interceptorChain
+	panicHandles     utils.HandlerList[*Socket, *HandlerPanicError]
+	slowHandles      utils.HandlerList[*Socket, *SlowConsumerError]
+	stateHandles     utils.HandlerList[*Socket, StateChange]
+
+	state          atomic.Int32
+	stateMux       sync.Mutex
+	stateQueue     []StateChange
+	stateNotifying bool
+
+	conn           Conn
+	transport      string
+	header         http.Header // request header of the current dial attempt
+	attemptHeader  http.Header // set by OnReconnectAttempt callbacks
+	attemptQuery   url.Values
 	status         atomic.Int32
 	sid            string
+	resumeSid      string // the sid of the lost connection, see Options.ResumeSession
+	resumed        atomic.Bool
+	upgrades       []string
 	pingInterval   time.Duration
 	pingTimeout    time.Duration
 	maxPayload     int
 	reDialCount    int
-	reDialTimeout  time.Duration
+	reDialTimeout  time.Duration // the delay of the next reconnect
+	reDialDelay    time.Duration // the delay of the scheduled reconnect
 	reconnectTimer atomic.Pointer[time.Timer]
+	suspended      atomic.Bool
+	closing        atomic.Bool
+	closeReason    error
+	lastWrite      atomic.Int64
+	lastRead       atomic.Int64
+	slowDispatch   atomic.Bool
+	sentStats      packetCounters
+	recvStats      packetCounters
+	reconnects     atomic.Uint64
+	lastRTT        atomic.Int64
+	connectedAt    atomic.Int64
+	slowQueue      atomic.Bool
+	writeMux       sync.Mutex
 
 	msgbuf []*Packet
+
+	pingMux sync.Mutex
+	pings   map[string][]chan struct{}
+
+	limiter *rateLimiter
+	// closed is closed by Close to stop the waiting of the rate limiter, Dial replaces it
+	closed chan struct{}
+
+	chunkSeq atomic.Uint64
+	chunks   map[uint64]*chunkedMessage
 }
 
 type Options struct {
@@ -98,6 +164,127 @@ type Options struct {
 	ExtraQuery   url.Values
 	ExtraHeaders http.Header
 	DialTimeout  time.Duration
+	// WebsocketDialer is used by the websocket transport instead of the package-level WebsocketDialer
+	WebsocketDialer *websocket.Dialer
+	// RoundTripper sends the requests of the polling transport, default is http.DefaultTransport.
+	// NetDialer and IPPreference do not apply to it
+	RoundTripper http.RoundTripper
+	// NetDialer opens the TCP connections of the builtin transports, its Timeout applies to
+	// every resolved address separately and its Resolver is used to look up the host
+	NetDialer *net.Dialer
+	// IPPreference selects which IP family is used or tried first
+	IPPreference IPPreference
+	// NetDialContext replaces NetDialer and IPPreference to open the connections of the builtin transports,
+	// e.g. to connect over a unix socket or an in-process tunnel. The addr is the host of the URL
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// HeaderProvider is called before every dial attempt,
+	// the returned headers override the ones in ExtraHeaders
+	HeaderProvider func(ctx context.Context) (http.Header, error)
+	// Endpoints are tried in order on every dial until one of them connects,
+	// Host and HostProvider are ignored if it is set
+	Endpoints *Endpoints
+	// HostProvider is called before every dial attempt, the returned host
+	// in the same format as Host replaces the current one
+	HostProvider func(ctx context.Context) (string, error)
+	// QueryProvider is called before every dial attempt,
+	// the returned values override the ones in ExtraQuery
+	QueryProvider func(ctx context.Context) (url.Values, error)
+	// MaxRedirects is the number of redirects followed by the handshake, default is 10.
+	// A negative value disables redirects
+	MaxRedirects int
+	// CrossOriginRedirects allows the handshake to be redirected to another scheme or host
+	CrossOriginRedirects bool
+	// Protocol is the Engine.IO protocol version, Protocol or ProtocolV3. Default is Protocol.
+	// ProtocolV3 only supports the websocket transport
+	Protocol int
+	// Transports are the transport names that will be attempted in order,
+	// the next one is only tried when the previous one failed to dial.
+	// Default is websocket only
+	Transports []string
+	// CustomTransports are looked up by name before the builtin transports
+	CustomTransports map[string]Transport
+	// Strict enables protocol validation, violations are reported as *ProtocolError.
+	// Outgoing packets larger than maxPayload will be rejected,
+	// received text frames must be valid UTF-8 and nothing but OPEN can be received before the handshake
+	Strict bool
+	// Upgrade probes the websocket transport after a polling handshake which offers it,
+	// and switches to websocket once the polling transport is paused, like the JS client does.
+	// The progress is reported by the StateUpgrading state
+	Upgrade bool
+	// IgnoreUnknownPackets ignores the received packets of unknown or unsupported types instead of closing the connection,
+	// for forward compatibility with newer servers. It has no effect in Strict mode
+	IgnoreUnknownPackets bool
+
+	// DisableReconnection stops the socket from reconnecting in background after the connection was lost,
+	// for callers who manage reconnection themselves
+	DisableReconnection bool
+	// ResumeSession sends the sid of the lost connection in the query of the reconnects,
+	// so servers which support it can resume the session, see Socket.Resumed.
+	// It only works with the websocket transport
+	ResumeSession bool
+	// MaxReconnectAttempts is the number of failed reconnect attempts after which the socket
+	// enters SocketFailed and stops reconnecting, zero means no limit
+	MaxReconnectAttempts int
+
+	// PingGrace is added to pingInterval + pingTimeout before the connection is considered dead,
+	// e.g. set it to the pingInterval to tolerate one missed PING
+	PingGrace time.Duration
+
+	// ReadDeadline makes every websocket read expire after pingInterval + pingTimeout,
+	// so a half-open connection is detected even if the PING packet never arrives
+	ReadDeadline bool
+	// ReadLimit is the maximum size of a received websocket message or polling response.
+	// Zero uses the maxPayload of the handshake, a negative value disables the limit.
+	// Exceeding it closes the connection with *ReadLimitError.
+	// A positive value also limits the size of a message reassembled by PayloadChunk, which is 64 MiB otherwise
+	ReadLimit int64
+	// WriteTimeout is the deadline of a single websocket write, zero means no deadline
+	WriteTimeout time.Duration
+	// KeepAlive is the idle duration after which a websocket ping control frame will be sent,
+	// zero disables the keepalive
+	KeepAlive time.Duration
+
+	// FlushInterval coalesces the websocket frames written within the interval, e.g. 1ms,
+	// into a single write to the network connection, which reduces the syscalls under bursty emits.
+	// Every frame is still delayed by up to the interval. The polling transport always batches
+	// the packets emitted while a request is in flight
+	FlushInterval time.Duration
+
+	// ZeroCopy makes the OnPong, OnBinary, OnMessage and OnRecv callbacks receive the internal read buffer
+	// instead of a copy. The data is then only valid until the callback returns, and must not be modified.
+	// It has no effect unless Dispatch is DispatchSync.
+	// ZeroCopy also encodes the sent packets into pooled buffers, so the data passed to OnSend,
+	// OnSendFrame and the send interceptors is only valid until they return
+	ZeroCopy bool
+
+	// Dispatch controls which goroutine runs the OnMessage and OnBinary callbacks,
+	// so a slow callback will not delay the PING handling. Default is DispatchSync.
+	// The Socket.IO layer requires the packets in order, it cannot be used with DispatchPool
+	Dispatch DispatchMode
+	// DispatchQueueSize is the number of packets can be queued before the reader blocks, default is 256
+	DispatchQueueSize int
+	// DispatchWorkers is the number of goroutines for DispatchPool, default is GOMAXPROCS
+	DispatchWorkers int
+
+	// PayloadPolicy decides what to do with messages larger than the server's maxPayload.
+	// Default is PayloadAllow
+	PayloadPolicy PayloadPolicy
+
+	// Trace logs every frame sent and received, it can be changed at runtime with SetTrace
+	Trace *log.Logger
+
+	// BinaryCompression enables the gzip compression of the binary bodies, the peer must enable it too
+	BinaryCompression *BinaryCompression
+
+	// RateLimit limits the messages sent by Emit and EmitBinary
+	RateLimit *RateLimit
+
+	// SlowConsumer enables the slow consumer detection, see OnSlowConsumer
+	SlowConsumer *SlowConsumer
+
+	// ContinueOnPanic keeps the connection open after a callback panicked.
+	// By default the connection will be closed with a *HandlerPanicError
+	ContinueOnPanic bool
 }
 
 var DefaultOption = Options{
@@ -106,36 +293,81 @@ var DefaultOption = Options{
 }
 
 func NewSocket(opts Options) (s *Socket, err error) {
-	if i := strings.Index(opts.Host, "://"); i > 0 {
-		scheme := opts.Host[:i]
-		opts.Host = opts.Host[i+len("://"):]
-		opts.Secure = !(scheme == "ws" || scheme == "http")
-	}
+	opts.Host, opts.Secure = splitHost(opts.Host, opts.Secure)
 	dialURL := url.URL{
-		Host: opts.Host,
-		Path: opts.Path,
-	}
-	if opts.Secure {
-		dialURL.Scheme = "wss"
-	} else {
-		dialURL.Scheme = "ws"
+		Host:   opts.Host,
+		Path:   opts.Path,
+		Scheme: wsScheme(opts.Secure),
 	}
 	query := make(url.Values, 2+len(opts.ExtraQuery))
 	for k, v := range opts.ExtraQuery {
 		query[k] = v
 	}
-	query.Set("EIO", strconv.Itoa(Protocol))
-	query.Set("transport", "websocket")
+	switch opts.Protocol {
+	case 0:
+		opts.Protocol = Protocol
+	case Protocol, ProtocolV3:
+	default:
+		return nil, fmt.Errorf("Engine.IO: unsupported protocol version %d", opts.Protocol)
+	}
+	query.Set("EIO", strconv.Itoa(opts.Protocol))
 	dialURL.RawQuery = query.Encode()
 
+	if len(opts.Transports) == 0 {
+		opts.Transports = []string{TransportWebsocket}
+	}
+	for _, name := range opts.Transports {
+		if _, err = opts.getTransport(name); err != nil {
+			return
+		}
+		if opts.Protocol == ProtocolV3 && name == TransportPolling {
+			return nil, &UnsupportedTransportError{name}
+		}
+	}
+
+	dialer := opts.WebsocketDialer
+	if dialer == nil {
+		dialer = WebsocketDialer
+	}
 	s = &Socket{
-		Dialer: WebsocketDialer,
+		Dialer: dialer,
 		opts:   opts,
 		url:    dialURL,
+
+		limiter: newRateLimiter(opts.RateLimit),
+		closed:  make(chan struct{}),
 	}
+	s.tracer.Store(opts.Trace)
 	return
 }
 
+// splitHost strips the scheme from host, and reports whether the scheme is secure
+func splitHost(host string, secure bool) (string, bool) {
+	if i := strings.Index(host, "://"); i > 0 {
+		scheme := host[:i]
+		host = host[i+len("://"):]
+		secure = !(scheme == "ws" || scheme == "http")
+	}
+	return host, secure
+}
+
+func wsScheme(secure bool) string {
+	if secure {
+		return "wss"
+	}
+	return "ws"
+}
+
+// Protocol returns the Engine.IO protocol version of the socket
+func (s *Socket) Protocol() int {
+	return s.opts.Protocol
+}
+
+// DispatchMode returns the Options.Dispatch of the socket
+func (s *Socket) DispatchMode() DispatchMode {
+	return s.opts.Dispatch
+}
+
 func (s *Socket) Status() SocketStatus {
 	return s.status.Load()
 }
@@ -144,22 +376,67 @@ func (s *Socket) Connected() bool {
 	return s.Status() == SocketConnected
 }
 
+// Resumed reports whether the server accepted to resume the previous session on the last reconnect,
+// see Options.ResumeSession
+func (s *Socket) Resumed() bool {
+	return s.resumed.Load()
+}
+
 func (s *Socket) ID() string {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 	return s.sid
 }
 
+// Handshake is the parameters sent by the server in the OPEN packet
+type Handshake struct {
+	Sid          string
+	Upgrades     []string
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	MaxPayload   int
+}
+
+// Handshake returns the parameters of the last OPEN packet,
+// the result is zero before the socket is opened and Sid is cleared once the connection closed
+func (s *Socket) Handshake() Handshake {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return Handshake{
+		Sid:          s.sid,
+		Upgrades:     append(([]string)(nil), s.upgrades...),
+		PingInterval: s.pingInterval,
+		PingTimeout:  s.pingTimeout,
+		MaxPayload:   s.maxPayload,
+	}
+}
+
 func (s *Socket) Context() context.Context {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 	return s.ctx
 }
 
+// Conn returns the underlying websocket connection,
+// or nil if the socket is not connected via websocket
 func (s *Socket) Conn() *websocket.Conn {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
-	return s.wsconn
+	conn := s.conn
+	if uc, ok := conn.(*upgradeConn); ok {
+		conn = uc.current()
+	}
+	if c, ok := conn.(*wsConn); ok {
+		return c.Conn
+	}
+	return nil
+}
+
+// Transport returns the name of the transport in use
+func (s *Socket) Transport() string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.transport
 }
 
 func (s *Socket) URL() *url.URL {
@@ -182,50 +459,198 @@ func (ctx *DialErrorContext) Err() error {
 	return ctx.err
 }
 
+// Response returns the unexpected response of the server, or nil if the dial failed before the server responded.
+// The response body can be read by ResponseBody
+func (ctx *DialErrorContext) Response() *http.Response {
+	var re *ResponseError
+	if errors.As(ctx.err, &re) {
+		return re.Response
+	}
+	return nil
+}
+
+// ResponseBody returns the beginning of the unexpected response body
+func (ctx *DialErrorContext) ResponseBody() []byte {
+	var re *ResponseError
+	if errors.As(ctx.err, &re) {
+		return re.Body
+	}
+	return nil
+}
+
+// ReDial reports whether the socket will try to reconnect
 func (ctx *DialErrorContext) ReDial() bool {
 	return ctx.reDial
 }
 
+// CancelReDial stops reconnecting, the socket will enter SocketFailed
 func (ctx *DialErrorContext) CancelReDial() {
-	ctx.reDial = true
+	ctx.reDial = false
 }
 
-func (s *Socket) dial(ctx context.Context) (err error) {
-	var wsconn *websocket.Conn
+func (s *Socket) dialTransport(ctx context.Context, t Transport) (Conn, error) {
 	if s.opts.DialTimeout > 0 {
 		tctx, cancel := context.WithTimeout(ctx, s.opts.DialTimeout)
-		wsconn, _, err = s.Dialer.DialContext(tctx, s.url.String(), s.opts.ExtraHeaders)
-		cancel()
+		defer cancel()
+		ctx = tctx
+	}
+	u, err := s.prepareDial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.Dial(ctx, s, u)
+}
+
+func (s *Socket) setHost(host string) {
+	var secure bool
+	s.url.Host, secure = splitHost(host, s.opts.Secure)
+	s.url.Scheme = wsScheme(secure)
+}
+
+// prepareDial evaluates the host, header and query providers
+func (s *Socket) prepareDial(ctx context.Context) (u *url.URL, err error) {
+	if s.opts.HostProvider != nil && s.opts.Endpoints == nil {
+		var host string
+		if host, err = s.opts.HostProvider(ctx); err != nil {
+			return
+		}
+		s.setHost(host)
+	}
+	u = &s.url
+	s.header = s.opts.ExtraHeaders
+	if s.opts.HeaderProvider != nil {
+		var header http.Header
+		if header, err = s.opts.HeaderProvider(ctx); err != nil {
+			return
+		}
+		s.header = mergeHeader(s.header, header)
+	}
+	if s.attemptHeader != nil {
+		s.header = mergeHeader(s.header, s.attemptHeader)
+	}
+	var query, resume url.Values
+	if s.opts.QueryProvider != nil {
+		if query, err = s.opts.QueryProvider(ctx); err != nil {
+			return
+		}
+	}
+	if s.resumeSid != "" {
+		resume = url.Values{"sid": {s.resumeSid}}
+	}
+	if query != nil || s.attemptQuery != nil || resume != nil {
+		q := u.Query()
+		for _, values := range []url.Values{query, s.attemptQuery, resume} {
+			for k, v := range values {
+				if k != "EIO" {
+					q[k] = v
+				}
+			}
+		}
+		u2 := *u
+		u2.RawQuery = q.Encode()
+		u = &u2
+	}
+	return
+}
+
+// mergeHeader returns a copy of base with the keys in extra replaced
+func mergeHeader(base, extra http.Header) http.Header {
+	h := base.Clone()
+	if h == nil {
+		h = make(http.Header, len(extra))
+	}
+	for k, v := range extra {
+		h[k] = v
+	}
+	return h
+}
+
+func (s *Socket) dialTransports(ctx context.Context) (conn Conn, t Transport, err error) {
+	for _, name := range s.opts.Transports {
+		if t, err = s.opts.getTransport(name); err != nil {
+			continue
+		}
+		if conn, err = s.dialTransport(ctx, t); err == nil {
+			return
+		}
+		err = &DialError{
+			Transport: name,
+			Err:       err,
+		}
+	}
+	return
+}
+
+func (s *Socket) dial(ctx context.Context) (err error) {
+	var (
+		conn Conn
+		t    Transport
+	)
+	if eps := s.opts.Endpoints; eps != nil && len(eps.endpoints) > 0 {
+		for _, host := range eps.candidates() {
+			s.setHost(host)
+			conn, t, err = s.dialTransports(ctx)
+			eps.report(host, err)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
 	} else {
-		wsconn, _, err = s.Dialer.DialContext(ctx, s.url.String(), s.opts.ExtraHeaders)
+		conn, t, err = s.dialTransports(ctx)
 	}
 	if err != nil {
 		return
 	}
+	if pc, ok := conn.(*pollingConn); ok && s.opts.Upgrade {
+		conn = newUpgradeConn(pc)
+	}
 	s.ctx, s.cancel = context.WithCancelCause(s.dialCtx)
-	s.wsconn = wsconn
-	s.msgbuf = s.msgbuf[:0]
+	s.conn = conn
+	s.closeReason = nil
+	s.transport = t.Name()
+	// the emitted messages are kept for the new connection,
+	// but the control packets only belong to the previous one
+	kept := s.msgbuf[:0]
+	for i, pkt := range s.msgbuf {
+		s.msgbuf[i] = nil
+		if pkt.typ == MESSAGE || pkt.typ == BINARY {
+			kept = append(kept, pkt)
+		} else {
+			pkt.Release()
+		}
+	}
+	s.msgbuf = kept
+	s.chunks = nil
 	s.reDialCount = 0
 	s.reDialTimeout = time.Second
 
 	return
 }
 
+// Dial connects to the server, ctx controls the lifetime of the connection and the reconnects.
+// A closed or failed socket can be dialed again, the state of the previous connection is reset.
+// It returns ErrSocketConnected if the socket is connected or waiting to reconnect
 func (s *Socket) Dial(ctx context.Context) (err error) {
-	if s.status.Load() != SocketClosed {
+	if st := s.State(); st != StateClosed && st != StateFailed {
 		return ErrSocketConnected
 	}
 
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	if !s.status.CompareAndSwap(SocketClosed, SocketOpening) || s.wsconn != nil {
+	if st := s.State(); st != StateClosed && st != StateFailed {
+		return ErrSocketConnected
+	}
+	if !s.status.CompareAndSwap(SocketClosed, SocketOpening) && !s.status.CompareAndSwap(SocketFailed, SocketOpening) {
 		return ErrSocketConnected
 	}
 
+	s.resetLocked()
 	s.dialCtx = ctx
+	s.setState(StateDialing, nil)
 	if err = s.dial(ctx); err != nil {
 		s.status.Store(SocketClosed)
+		s.setState(StateClosed, err)
 		s.dialErrorHandles.Call(s, &DialErrorContext{
 			count: -1,
 			err:   err,
@@ -233,16 +658,48 @@ func (s *Socket) Dial(ctx context.Context) (err error) {
 		return
 	}
 
-	go s._reader(s.ctx, s.wsconn)
+	s.setState(StateHandshaking, nil)
+	go s._reader(s.ctx, s.conn)
 
 	return
 }
 
+// resetLocked clears the state left by the previous connection, s.mux must be held
+func (s *Socket) resetLocked() {
+	if timer := s.reconnectTimer.Swap(nil); timer != nil {
+		timer.Stop()
+	}
+	s.conn = nil
+	s.sid = ""
+	s.resumeSid = ""
+	s.resumed.Store(false)
+	s.upgrades = nil
+	s.pingInterval = 0
+	s.pingTimeout = 0
+	s.maxPayload = 0
+	s.closeReason = nil
+	s.reDialCount = 0
+	s.reDialTimeout = time.Second
+	s.suspended.Store(false)
+	s.closing.Store(false)
+	select {
+	case <-s.closed:
+		s.closed = make(chan struct{})
+	default:
+	}
+	s.connectedAt.Store(0)
+}
+
 func (s *Socket) reDial() (err error) {
 	if s.status.Load() != SocketClosed {
 		return ErrSocketConnected
 	}
 
+	attempt, err := s.onReconnectAttempt()
+	if err != nil {
+		return
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
@@ -250,18 +707,40 @@ func (s *Socket) reDial() (err error) {
 		return ErrSocketConnected
 	}
 
+	s.attemptHeader, s.attemptQuery = attempt.Header, attempt.Query
+	defer func() {
+		s.attemptHeader, s.attemptQuery = nil, nil
+	}()
+
+	s.setState(StateDialing, nil)
 	if err = s.dial(s.dialCtx); err != nil {
+		var (
+			re *ResponseError
+			he *HandshakeError
+		)
+		if errors.As(err, &re) || errors.As(err, &he) {
+			// the server rejected the session, the next attempt will start a new one
+			s.resumeSid = ""
+		}
 		s.reDialCount++
 		s.status.Store(SocketClosed)
-		s.dialErrorHandles.Call(s, &DialErrorContext{
-			count: s.reDialCount,
-			err:   err,
-		})
+		dctx := &DialErrorContext{
+			count:  s.reDialCount,
+			err:    err,
+			reDial: s.opts.MaxReconnectAttempts <= 0 || s.reDialCount < s.opts.MaxReconnectAttempts,
+		}
+		s.dialErrorHandles.Call(s, dctx)
+		if !dctx.reDial {
+			s.status.Store(SocketFailed)
+			s.setState(StateFailed, err)
+		}
 		return
 	}
 
-	go s._reader(s.ctx, s.wsconn)
+	s.setState(StateHandshaking, nil)
+	go s._reader(s.ctx, s.conn)
 
+	s.reconnects.Add(1)
 	s.reconnectHandles.Call(s, struct{}{})
 
 	return
@@ -273,43 +752,140 @@ func (s *Socket) onMessage(data []byte) {
 
 func (s *Socket) nextReconnect(ctx context.Context) {
 	s.mux.Lock()
-	defer s.mux.Unlock()
 	if timer := s.reconnectTimer.Swap(nil); timer != nil {
 		timer.Stop()
 	}
-
-	if s.reDialTimeout < time.Minute*5 {
-		s.reDialTimeout = s.reDialTimeout * 2
+	if s.opts.DisableReconnection {
+		s.mux.Unlock()
+		s.setState(StateClosed, nil)
+		return
+	}
+	if max := s.opts.MaxReconnectAttempts; max > 0 && s.reDialCount >= max {
+		s.status.CompareAndSwap(SocketClosed, SocketFailed)
 	}
+	if s.Status() == SocketFailed {
+		s.mux.Unlock()
+		s.setState(StateFailed, nil)
+		s.protect(func() {
+			s.reconnectFailedHandles.Call(s, struct{}{})
+		})
+		return
+	}
+	defer s.mux.Unlock()
+
+	s.setState(StateReconnecting, nil)
+	s.reDialDelay = s.reDialTimeout
+	s.reDialTimeout = min(s.reDialTimeout*2, time.Minute*5)
 	stop := context.AfterFunc(ctx, func() {
 		if timer := s.reconnectTimer.Swap(nil); timer != nil {
 			timer.Stop()
 		}
 	})
-	s.reconnectTimer.Store(time.AfterFunc(s.reDialTimeout, func() {
+	s.reconnectTimer.Store(time.AfterFunc(s.reDialDelay, func() {
 		s.reconnectTimer.Store(nil)
 		stop()
-		if err := s.reDial(); err != nil {
+		if s.suspended.Load() || s.closing.Load() {
+			return
+		}
+		var err error
+		s.protect(func() {
+			err = s.reDial()
+		})
+		// ErrSocketConnected means TriggerReconnect or Resume dialed in the meantime
+		if err != nil && err != ErrSocketConnected {
 			s.nextReconnect(ctx)
 		}
 	}))
 }
 
 func (s *Socket) onClose(err error) {
+	if s.closing.Load() {
+		// the connection was closed by Close
+		err = nil
+	}
+	s.closeConn(err, err != nil)
+}
+
+func (s *Socket) closeConn(err error, reDial bool) {
+	if st := s.status.Load(); st == SocketClosed || st == SocketFailed {
+		return
+	}
 	if s.status.Swap(SocketClosed) == SocketClosed {
 		return
 	}
 
+	s.mux.Lock()
+	s.closeReason = err
+	if s.opts.ResumeSession && s.sid != "" {
+		s.resumeSid = s.sid
+	}
+	s.sid = ""
+	if s.conn != nil {
+		s.conn.Close()
+		s.cancel(err)
+	}
+	dialCtx := s.dialCtx
+	s.mux.Unlock()
+
+	s.protect(func() {
+		s.disconnectHandles.Call(s, err)
+	})
+	if reDial && !s.suspended.Load() && !s.opts.DisableReconnection {
+		s.setState(StateReconnecting, err)
+		s.nextReconnect(dialCtx)
+	} else {
+		s.setState(StateClosed, err)
+	}
+}
+
+// Suspend closes the connection and stops reconnecting until Resume is called,
+// e.g. when the system is going to sleep
+func (s *Socket) Suspend() {
+	s.suspended.Store(true)
+	if timer := s.reconnectTimer.Swap(nil); timer != nil {
+		timer.Stop()
+	}
+	s.closeNow()
+}
+
+// Resume dials immediately after Suspend, if it failed the socket keeps reconnecting with backoff
+func (s *Socket) Resume() (err error) {
+	if !s.suspended.Swap(false) {
+		return nil
+	}
 	s.mux.RLock()
-	s.wsconn.Close()
-	s.cancel(err)
 	dialCtx := s.dialCtx
 	s.mux.RUnlock()
-
-	s.disconnectHandles.Call(s, err)
-	if err != nil {
+	if dialCtx == nil {
+		return ErrNotConnected
+	}
+	s.protect(func() {
+		err = s.reDial()
+	})
+	if err != nil && err != ErrSocketConnected {
 		s.nextReconnect(dialCtx)
 	}
+	return
+}
+
+// Suspended reports whether the socket is suspended
+func (s *Socket) Suspended() bool {
+	return s.suspended.Load()
+}
+
+// CloseReason returns why the last connection was closed,
+// a *ServerCloseError means the server closed the connection.
+// It returns nil if the socket is connected or was closed by the client
+func (s *Socket) CloseReason() error {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.closeReason
+}
+
+// OnOpen registers the callback which is called with the raw JSON body of the OPEN packet,
+// including the fields unknown to this package. It is called before the OnConnect callbacks
+func (s *Socket) OnOpen(cb func(s *Socket, handshake []byte)) {
+	s.openHandles.On(cb)
 }
 
 func (s *Socket) OnConnect(cb func(s *Socket)) {
@@ -342,6 +918,25 @@ func (s *Socket) OnReconnect(cb func(s *Socket)) {
 	})
 }
 
+// Data passed to the OnPong, OnBinary, OnMessage and OnRecv callbacks is owned by the callbacks,
+// unless Options.ZeroCopy is set, see the comment there.
+
+// OnPingExpected registers the callback which is called when the PING is due,
+// i.e. nothing was received for pingInterval
+func (s *Socket) OnPingExpected(cb func(s *Socket)) {
+	s.pingExpectedHandles.On(func(s *Socket, _ struct{}) {
+		cb(s)
+	})
+}
+
+// OnPingMissed registers the callback which is called when nothing was received for
+// pingInterval + pingTimeout, the connection will be closed after PingGrace
+func (s *Socket) OnPingMissed(cb func(s *Socket)) {
+	s.pingMissedHandles.On(func(s *Socket, _ struct{}) {
+		cb(s)
+	})
+}
+
 func (s *Socket) OnPong(cb func(s *Socket, data []byte)) {
 	s.pongHandles.On(cb)
 }
@@ -350,12 +945,67 @@ func (s *Socket) OncePong(cb func(s *Socket, data []byte)) {
 	s.pongHandles.Once(cb)
 }
 
-func (s *Socket) OnBinary(cb func(s *Socket, data []byte)) {
+// OnUnknownPacket registers the callback which receives the text frames of unknown or unsupported packet types,
+// the connection is closed after the callbacks unless IgnoreUnknownPackets is set
+func (s *Socket) OnUnknownPacket(cb func(s *Socket, data []byte)) {
+	s.unknownHandles.On(cb)
+}
+
+// onUnknownPacket passes the frame to the OnUnknownPacket callbacks,
+// and reports whether the packet should be ignored
+func (s *Socket) onUnknownPacket(buf []byte) bool {
+	s.unknownHandles.Call(s, s.handlerData(buf))
+	return s.opts.IgnoreUnknownPackets && !s.opts.Strict
+}
+
+// BinaryOrigin tells how a binary payload was carried by the transport
+type BinaryOrigin uint8
+
+const (
+	// OriginFrame is a binary frame of the transport, e.g. websocket
+	OriginFrame BinaryOrigin = iota
+	// OriginPacket is a base64 encoded BINARY packet of a text-only transport, e.g. polling
+	OriginPacket
+)
+
+func (o BinaryOrigin) String() string {
+	switch o {
+	case OriginFrame:
+		return "frame"
+	case OriginPacket:
+		return "packet"
+	}
+	return fmt.Sprintf("BinaryOrigin(%d)", (uint8)(o))
+}
+
+// Binary is a received binary payload, each payload is delivered once whatever its origin is
+type Binary struct {
+	Origin BinaryOrigin
+	Data   []byte
+}
+
+// OnBinaryData is like OnBinary, but the callback also receives the origin of the payload
+func (s *Socket) OnBinaryData(cb func(s *Socket, b Binary)) {
 	s.binaryHandlers.On(cb)
 }
 
+func (s *Socket) OnBinary(cb func(s *Socket, data []byte)) {
+	s.binaryHandlers.On(func(s *Socket, b Binary) {
+		cb(s, b.Data)
+	})
+}
+
 func (s *Socket) OnceBinary(cb func(s *Socket, data []byte)) {
-	s.binaryHandlers.Once(cb)
+	s.binaryHandlers.Once(func(s *Socket, b Binary) {
+		cb(s, b.Data)
+	})
+}
+
+// OnBinaryContext is like OnBinary, but the callback receives the connection's Context
+func (s *Socket) OnBinaryContext(cb func(ctx context.Context, s *Socket, data []byte)) {
+	s.binaryHandlers.On(func(s *Socket, b Binary) {
+		cb(s.Context(), s, b.Data)
+	})
 }
 
 func (s *Socket) OnMessage(cb func(s *Socket, data []byte)) {
@@ -366,6 +1016,20 @@ func (s *Socket) OnceMessage(cb func(s *Socket, data []byte)) {
 	s.messageHandles.Once(cb)
 }
 
+// OnMessageContext is like OnMessage, but the callback receives the connection's Context,
+// which will be canceled when the connection is closed
+func (s *Socket) OnMessageContext(cb func(ctx context.Context, s *Socket, data []byte)) {
+	s.messageHandles.On(func(s *Socket, data []byte) {
+		cb(s.Context(), s, data)
+	})
+}
+
+// OnHandlerPanic registers a callback for panics recovered from the other callbacks.
+// If no callback is registered, the panic will be logged
+func (s *Socket) OnHandlerPanic(cb func(s *Socket, err *HandlerPanicError)) {
+	s.panicHandles.On(cb)
+}
+
 func (s *Socket) OnRecv(cb func(s *Socket, data []byte)) {
 	s.recvHandles.On(cb)
 }
@@ -374,44 +1038,73 @@ func (s *Socket) OnSend(cb func(s *Socket, data []byte)) {
 	s.sendHandles.On(cb)
 }
 
-func (s *Socket) _reader(ctx context.Context, wsconn *websocket.Conn) {
-	defer wsconn.Close()
-	defer s.status.Store(SocketClosed)
-
-	openCh := make(chan struct{}, 0)
+// Frame is a frame read from or written to the transport connection
+type Frame struct {
+	Binary bool
+	Data   []byte
+	// Time is when the frame was read, or when it is about to be written
+	Time time.Time
+}
 
-	pingTimer := time.NewTimer(time.Minute)
-	pingTimer.Stop()
+// OnRecvFrame registers the callback which receives every frame as it was read from the transport,
+// unlike OnRecv it includes the binary frames
+func (s *Socket) OnRecvFrame(cb func(s *Socket, frame Frame)) {
+	s.recvFrameHandles.On(cb)
+}
 
-	go func() {
-		defer wsconn.Close()
-		select {
-		case <-ctx.Done():
-			return
-		case <-openCh: // wait for the open packet
-		}
+// OnSendFrame registers the callback which receives every frame before it is written to the transport,
+// unlike OnSend it includes the binary frames, after the compression
+func (s *Socket) OnSendFrame(cb func(s *Socket, frame Frame)) {
+	s.sendFrameHandles.On(cb)
+}
 
-		// clear timer
-		pingTimer.Stop()
-		select {
-		case <-pingTimer.C:
-		default:
+// OnSendBinary registers the callback which receives the binary frames before they are written to the transport,
+// over text-only transports it receives the payloads of the BINARY packets
+func (s *Socket) OnSendBinary(cb func(s *Socket, data []byte)) {
+	s.sendFrameHandles.On(func(s *Socket, f Frame) {
+		if f.Binary {
+			cb(s, f.Data)
 		}
+	})
+}
 
-		select {
-		case <-ctx.Done():
-		case <-pingTimer.C:
-			s.onClose(ErrPingTimeout)
+func (s *Socket) _reader(ctx context.Context, conn Conn) {
+	defer conn.Close()
+	defer func() {
+		// the socket may have been dialed again before the reader of the closed connection exited
+		s.mux.RLock()
+		current := conn == s.conn
+		s.mux.RUnlock()
+		if current {
+			s.status.Store(SocketClosed)
 		}
 	}()
 
+	openCh := make(chan struct{}, 0)
+
+	s.lastRead.Store(time.Now().UnixNano())
+	go s._watchdog(ctx, conn, openCh)
+	if s.opts.Protocol == ProtocolV3 {
+		go s._heartbeat(ctx, openCh)
+	}
+
+	if rl, ok := conn.(readLimiter); ok && s.opts.ReadLimit > 0 {
+		rl.setReadLimit(s.opts.ReadLimit)
+	}
+	s.setupConn(ctx, conn, conn)
+
+	d := newDispatcher(&s.opts, s.protect)
+	defer d.stop()
+
 	pkt := new(Packet)
-	var buf []byte
 	for {
-		code, r, err := wsconn.NextReader()
+		bufp := getBuffer()
+		binary, data, err := conn.ReadFrame(*bufp)
+		*bufp = data
 		if err != nil {
+			putBuffer(bufp)
 			s.mux.RLock()
-			ok := wsconn == s.wsconn
+			ok := conn == s.conn
 			s.mux.RUnlock()
 			if ok {
 				s.onClose(err)
@@ -419,94 +1112,489 @@ func (s *Socket) _reader(ctx context.Context, wsconn *websocket.Conn) {
 			return
 		}
 
-		// reset ping timer
-		pingTimer.Reset(s.pingInterval + s.pingTimeout)
+		s.lastRead.Store(time.Now().UnixNano())
+		if s.opts.ReadDeadline {
+			s.extendReadDeadline(conn)
+		}
 
-		switch code {
-		case websocket.BinaryMessage:
-			if buf, err = utils.ReadAllTo(r, buf[:0]); err != nil {
-				s.onClose(err)
-				return
+		exit := s.onFrame(conn, d, pkt, binary, data, openCh)
+		putBuffer(bufp)
+		if exit {
+			return
+		}
+	}
+}
+
+// _heartbeat sends a PING packet every pingInterval after the handshake,
+// since in ProtocolV3 the server only answers the client's PING
+func (s *Socket) _heartbeat(ctx context.Context, openCh chan struct{}) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-openCh:
+	}
+	s.mux.RLock()
+	interval := s.pingInterval
+	s.mux.RUnlock()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.Connected() {
+			s.send(AcquirePacket(PING, nil))
+		}
+	}
+}
+
+// _watchdog closes the connection if nothing was received for pingInterval + pingTimeout + PingGrace
+// after the handshake. OnPingExpected callbacks are called after pingInterval,
+// and OnPingMissed callbacks after pingInterval + pingTimeout
+func (s *Socket) _watchdog(ctx context.Context, conn Conn, openCh chan struct{}) {
+	defer conn.Close()
+	select {
+	case <-ctx.Done():
+		return
+	case <-openCh: // wait for the open packet
+	}
+
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	stage := 0
+	for {
+		last := s.lastRead.Load()
+		s.mux.RLock()
+		deadline, pingTimeout := s.pingInterval, s.pingTimeout
+		s.mux.RUnlock()
+		if stage >= 1 {
+			deadline += pingTimeout
+		}
+		if stage >= 2 {
+			deadline += s.opts.PingGrace
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
 			}
-			s.binaryHandlers.Call(s, buf)
+		}
+		timer.Reset(time.Until(time.Unix(0, last).Add(deadline)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if s.lastRead.Load() != last {
+			// received a frame, restart the cycle
+			stage = 0
 			continue
-		case websocket.TextMessage:
-			if buf, err = utils.ReadAllTo(r, buf[:0]); err != nil {
-				s.onClose(err)
+		}
+		switch stage {
+		case 0:
+			s.protect(func() {
+				s.pingExpectedHandles.Call(s, struct{}{})
+			})
+		case 1:
+			s.protect(func() {
+				s.pingMissedHandles.Call(s, struct{}{})
+			})
+			if s.opts.PingGrace <= 0 {
+				s.onClose(&TimeoutError{ErrPingTimeout})
 				return
 			}
 		default:
-			continue
+			s.onClose(&TimeoutError{ErrPingTimeout})
+			return
 		}
+		stage++
+	}
+}
 
-		s.recvHandles.Call(s, buf)
+// onFrame dispatches a received frame, buf will be reused after it returns.
+// It returns true if the reader should exit
+func (s *Socket) onFrame(conn Conn, d *dispatcher, pkt *Packet, binary bool, buf []byte, openCh chan struct{}) (exit bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.onHandlerPanic(v)
+			exit = !s.opts.ContinueOnPanic
+		}
+	}()
 
-		if err = pkt.UnmarshalBinary(buf); err != nil {
-			s.onClose(err)
+	s.trace("recv", binary, buf)
+	if s.recvFrameHandles.Len() > 0 {
+		s.recvFrameHandles.Call(s, Frame{Binary: binary, Data: s.handlerData(buf), Time: time.Now()})
+	}
+	if s.recvInterceptors.len() > 0 {
+		f, err := s.recvInterceptors.run(s, Frame{Binary: binary, Data: buf, Time: time.Now()})
+		if err != nil {
+			if err == ErrDropFrame {
+				return
+			}
+			s.onClose(&InterceptError{err})
+			return true
+		}
+		binary, buf = f.Binary, f.Data
+	}
+
+	if binary {
+		s.recvStats.add(BINARY, len(buf))
+		s.onBinaryBody(d, OriginFrame, buf)
+		return
+	}
+
+	s.recvHandles.Call(s, s.handlerData(buf))
+
+	if s.opts.Strict && !utf8.Valid(buf) {
+		s.onClose(&ProtocolError{"received text frame is not valid UTF-8"})
+		return true
+	}
+
+	if err := pkt.UnmarshalBinary(buf); err != nil {
+		if _, ok := err.(*UnexpectedPacketTypeError); ok && s.onUnknownPacket(buf) {
 			return
 		}
+		if s.opts.Strict {
+			err = &ProtocolError{err.Error()}
+		}
+		s.onClose(err)
+		return true
+	}
+	s.recvStats.add(pkt.typ, len(buf))
+
+	if s.opts.Strict && pkt.typ != OPEN && s.Status() != SocketConnected {
+		s.onClose(&ProtocolError{fmt.Sprintf("received %s packet before OPEN", pkt.typ)})
+		return true
+	}
 
-		switch pkt.typ {
-		case BINARY:
-			s.binaryHandlers.Call(s, pkt.body)
-		case OPEN:
-			if s.Status() != SocketOpening {
+	switch pkt.typ {
+	case BINARY:
+		s.onBinaryBody(d, OriginPacket, pkt.body)
+	case OPEN:
+		if s.Status() != SocketOpening {
+			if s.opts.Strict {
+				s.onClose(&ProtocolError{"received OPEN packet twice"})
+			} else {
 				s.onClose(errMultipleOpen)
-				return
-			}
-			var obj struct {
-				Sid          string   `json:"sid"`
-				Upgrades     []string `json:"upgrades"`
-				PingInterval int      `json:"pingInterval"`
-				PingTimeout  int      `json:"pingTimeout"`
-				MaxPayload   int      `json:"maxPayload"`
 			}
-			if err := pkt.UnmarshalBody(&obj); err != nil {
+			return true
+		}
+		var obj struct {
+			Sid          string   `json:"sid"`
+			Upgrades     []string `json:"upgrades"`
+			PingInterval int      `json:"pingInterval"`
+			PingTimeout  int      `json:"pingTimeout"`
+			MaxPayload   int      `json:"maxPayload"`
+		}
+		if err := pkt.UnmarshalBody(&obj); err != nil {
+			s.onClose(&HandshakeError{err})
+			return
+		}
+
+		s.mux.Lock()
+		s.resumed.Store(s.resumeSid != "" && s.resumeSid == obj.Sid)
+		s.resumeSid = ""
+		s.sid = obj.Sid
+		s.upgrades = obj.Upgrades
+		s.pingInterval = (time.Duration)(obj.PingInterval) * time.Millisecond
+		s.pingTimeout = (time.Duration)(obj.PingTimeout) * time.Millisecond
+		s.maxPayload = obj.MaxPayload
+		if rl, ok := conn.(readLimiter); ok && s.opts.ReadLimit == 0 && obj.MaxPayload > 0 {
+			rl.setReadLimit((int64)(obj.MaxPayload))
+		}
+		s.mux.Unlock()
+
+		ctx, err := s.flush(conn)
+		if err != nil {
+			s.onClose(err)
+			return true
+		}
+
+		close(openCh)
+		if uc, ok := conn.(*upgradeConn); ok && !uc.upgraded() && slices.Contains(obj.Upgrades, TransportWebsocket) {
+			go s.upgrade(ctx, uc)
+		}
+
+		s.openHandles.Call(s, pkt.Clone().body)
+		s.connectHandles.Call(s, struct{}{})
+	case CLOSE:
+		s.closeConn(&ServerCloseError{}, false)
+		return true
+	case PING:
+		s.send(AcquirePacket(PONG, pkt.body))
+	case PONG:
+		s.onPong(pkt.body)
+		s.pongHandles.Call(s, s.handlerData(pkt.body))
+	case NOOP:
+		// the server ends the pending polling request with it, e.g. during upgrade
+	case MESSAGE:
+		body := pkt.body
+		if s.opts.PayloadPolicy == PayloadChunk && len(body) > 0 && body[0] == chunkMarker {
+			var (
+				done bool
+				err  error
+			)
+			if body, done, err = s.onChunk(body); err != nil {
 				s.onClose(err)
-				continue
+				return
+			} else if !done {
+				return
 			}
+		}
+		data := s.handlerData(body)
+		s.dispatch(d, func() {
+			s.onMessage(data)
+		})
+	default:
+		if s.onUnknownPacket(buf) {
+			return
+		}
+		if s.opts.Strict {
+			s.onClose(&ProtocolError{fmt.Sprintf("unsupported packet type %s", pkt.typ)})
+		} else {
+			s.onClose(fmt.Errorf("Engine.IO: unsupported packet type %s", pkt.typ))
+		}
+	}
+	return
+}
 
-			s.mux.Lock()
-			s.sid = obj.Sid
-			s.pingInterval = (time.Duration)(obj.PingInterval) * time.Millisecond
-			s.pingTimeout = (time.Duration)(obj.PingTimeout) * time.Millisecond
-			s.maxPayload = obj.MaxPayload
-			for _, pkt := range s.msgbuf {
-				s.sendPkt(wsconn, pkt)
-			}
-			s.msgbuf = s.msgbuf[:0]
-			s.status.Store(SocketConnected)
-			s.mux.Unlock()
+// onBinaryBody decompresses the body of a binary frame or BINARY packet and dispatches it
+func (s *Socket) onBinaryBody(d *dispatcher, origin BinaryOrigin, body []byte) {
+	if c := s.opts.BinaryCompression; c != nil {
+		var err error
+		if body, err = c.decode(body); err != nil {
+			s.onClose(err)
+			return
+		}
+	}
+	b := Binary{Origin: origin, Data: s.handlerData(body)}
+	s.dispatch(d, func() {
+		s.binaryHandlers.Call(s, b)
+	})
+}
+
+// protect calls fn and recovers if any callback panicked
+func (s *Socket) protect(fn func()) (panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicked = true
+			s.onHandlerPanic(v)
+		}
+	}()
+	fn()
+	return
+}
 
-			close(openCh)
+func (s *Socket) onHandlerPanic(v any) {
+	err := &HandlerPanicError{
+		Value: v,
+		Stack: debug.Stack(),
+	}
+	if s.panicHandles.Len() == 0 {
+		log.Printf("Engine.IO: recovered from callback panic: %v\n%s", v, err.Stack)
+	} else {
+		s.panicHandles.Call(s, err)
+	}
+	if !s.opts.ContinueOnPanic {
+		s.onClose(err)
+	}
+}
 
-			s.connectHandles.Call(s, struct{}{})
-		case CLOSE:
-			s.onClose(nil)
+// Ping sends a PING packet with the payload, and waits for the PONG packet with the same payload.
+// Engine.IO v4 servers are supposed to ping the clients, so the server must support client pings,
+// otherwise it may close the connection
+func (s *Socket) Ping(ctx context.Context, payload string) (rtt time.Duration, err error) {
+	if !s.Connected() {
+		return 0, ErrNotConnected
+	}
+	connCtx := s.Context()
+	ch := make(chan struct{}, 1)
+	s.pingMux.Lock()
+	if s.pings == nil {
+		s.pings = make(map[string][]chan struct{})
+	}
+	s.pings[payload] = append(s.pings[payload], ch)
+	s.pingMux.Unlock()
+	defer s.cancelPing(payload, ch)
+
+	start := time.Now()
+	if err = s.send(AcquirePacket(PING, ([]byte)(payload))); err != nil {
+		return
+	}
+	select {
+	case <-ch:
+		rtt = time.Since(start)
+		s.lastRTT.Store((int64)(rtt))
+		return rtt, nil
+	case <-connCtx.Done():
+		return 0, context.Cause(connCtx)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (s *Socket) cancelPing(payload string, ch chan struct{}) {
+	s.pingMux.Lock()
+	defer s.pingMux.Unlock()
+	waiting := s.pings[payload]
+	for i, c := range waiting {
+		if c == ch {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(s.pings, payload)
+	} else {
+		s.pings[payload] = waiting
+	}
+}
+
+func (s *Socket) onPong(body []byte) {
+	s.pingMux.Lock()
+	defer s.pingMux.Unlock()
+	waiting := s.pings[(string)(body)]
+	if len(waiting) == 0 {
+		return
+	}
+	waiting[0] <- struct{}{}
+	if len(waiting) == 1 {
+		delete(s.pings, (string)(body))
+	} else {
+		s.pings[(string)(body)] = waiting[1:]
+	}
+}
+
+// handlerData returns the data that can be passed to the callbacks
+func (s *Socket) handlerData(data []byte) []byte {
+	if s.opts.ZeroCopy && s.opts.Dispatch == DispatchSync {
+		return data
+	}
+	return append(make([]byte, 0, len(data)), data...)
+}
+
+// setupConn installs the pong handler and starts the keepalive if raw is a websocket connection,
+// conn is the connection read by the reader, which is different from raw after an upgrade
+func (s *Socket) setupConn(ctx context.Context, conn Conn, raw Conn) {
+	ws, ok := raw.(*wsConn)
+	if !ok {
+		return
+	}
+	if s.opts.ReadDeadline {
+		ws.SetPongHandler(func(string) error {
+			s.extendReadDeadline(conn)
+			return nil
+		})
+	}
+	if s.opts.KeepAlive > 0 {
+		go s._keepAlive(ctx, ws.Conn)
+	}
+}
+
+func (s *Socket) extendReadDeadline(conn Conn) {
+	c, ok := conn.(readDeadliner)
+	if !ok {
+		return
+	}
+	s.mux.RLock()
+	timeout := s.pingInterval + s.pingTimeout
+	s.mux.RUnlock()
+	if timeout > 0 {
+		c.SetReadDeadline(time.Now().Add(timeout))
+	}
+}
+
+func (s *Socket) _keepAlive(ctx context.Context, wsconn *websocket.Conn) {
+	ticker := time.NewTicker(s.opts.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, s.lastWrite.Load())) < s.opts.KeepAlive {
+			continue
+		}
+		timeout := s.opts.WriteTimeout
+		if timeout <= 0 {
+			timeout = s.opts.KeepAlive
+		}
+		if err := wsconn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout)); err != nil {
+			return
+		}
+		s.lastWrite.Store(time.Now().UnixNano())
+	}
+}
+
+func (s *Socket) sendPkt(conn Conn, pkt *Packet) (err error) {
+	binary := pkt.typ == BINARY
+	buf := pkt.body
+	if !binary {
+		if s.opts.ZeroCopy {
+			bp := getBuffer()
+			defer putBuffer(bp)
+			*bp, err = pkt.AppendBinary(*bp)
+			buf = *bp
+		} else {
+			buf, err = pkt.MarshalBinary()
+		}
+		if err != nil {
+			return
+		}
+	} else if c := s.opts.BinaryCompression; c != nil {
+		if buf, err = c.encode(buf); err != nil {
 			return
-		case PING:
-			pkt.typ = PONG
-			s.send(pkt)
-		case PONG:
-			s.pongHandles.Call(s, pkt.body)
-		case MESSAGE:
-			s.onMessage(pkt.body)
-		default:
-			s.onClose(fmt.Errorf("Engine.IO: unsupported packet type %s", pkt.typ))
 		}
 	}
+	return s.sendFrame(conn, pkt.typ, binary, buf)
 }
 
-func (s *Socket) sendPkt(wsconn *websocket.Conn, pkt *Packet) (err error) {
-	if pkt.typ == BINARY {
-		return wsconn.WriteMessage(websocket.BinaryMessage, pkt.body)
+// sendFrame passes an encoded frame through the send hooks and writes it,
+// typ is only used for the stats
+func (s *Socket) sendFrame(conn Conn, typ PacketType, binary bool, buf []byte) (err error) {
+	if s.sendInterceptors.len() > 0 {
+		var f Frame
+		if f, err = s.sendInterceptors.run(s, Frame{Binary: binary, Data: buf, Time: time.Now()}); err != nil {
+			if err == ErrDropFrame {
+				return nil
+			}
+			return &InterceptError{err}
+		}
+		binary, buf = f.Binary, f.Data
+	}
+	if !binary {
+		s.sendHandles.Call(s, buf)
+	}
+	s.trace("send", binary, buf)
+	if s.sendFrameHandles.Len() > 0 {
+		s.sendFrameHandles.Call(s, Frame{Binary: binary, Data: buf, Time: time.Now()})
 	}
-	var buf []byte
-	if buf, err = pkt.MarshalBinary(); err != nil {
+	if err = s.writeFrame(conn, binary, buf); err != nil {
 		return
 	}
-	s.sendHandles.Call(s, buf)
-	return wsconn.WriteMessage(websocket.TextMessage, buf)
+	s.sentStats.add(typ, len(buf))
+	return
+}
+
+// writeFrame serializes all writes to the transport connection,
+// since the connections are not safe for concurrent writes
+func (s *Socket) writeFrame(conn Conn, binary bool, data []byte) error {
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+
+	s.lastWrite.Store(time.Now().UnixNano())
+	if s.opts.WriteTimeout > 0 {
+		if c, ok := conn.(writeDeadliner); ok {
+			c.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout))
+		}
+	}
+	return conn.WriteFrame(binary, data)
 }
 
 func (s *Socket) Close() error {
@@ -514,33 +1602,202 @@ func (s *Socket) Close() error {
 	if reconnectTimer != nil {
 		reconnectTimer.Stop()
 	}
-	if s.Status() != SocketClosed {
-		s.send(&Packet{
-			typ: CLOSE,
-		})
+	s.closing.Store(true)
+	s.mux.Lock()
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	s.mux.Unlock()
+	s.closeNow()
+	return nil
+}
+
+// closeNow sends the CLOSE packet if connected, and then closes the connection without reconnecting
+func (s *Socket) closeNow() {
+	s.mux.RLock()
+	conn := s.conn
+	s.mux.RUnlock()
+	if s.Status() == SocketConnected && conn != nil {
+		pkt := AcquirePacket(CLOSE, nil)
+		s.sendPkt(conn, pkt)
+		pkt.Release()
+	}
+	s.closeConn(nil, false)
+	if s.State() == StateReconnecting {
+		s.setState(StateClosed, nil)
+	}
+}
+
+// flush sends the packets buffered before the handshake completed, and then marks the socket connected.
+// The lock is not held while sending, since the send hooks and interceptors may call back into the socket.
+// The status stays SocketOpening until the buffer is empty, so the packets emitted meanwhile are queued behind
+func (s *Socket) flush(conn Conn) (ctx context.Context, err error) {
+	for {
+		s.mux.Lock()
+		pending := s.msgbuf
+		if len(pending) == 0 {
+			if !s.status.CompareAndSwap(SocketOpening, SocketConnected) {
+				s.mux.Unlock()
+				return nil, ErrNotConnected
+			}
+			s.connectedAt.Store(time.Now().UnixNano())
+			s.setState(StateConnected, nil)
+			ctx = s.ctx
+			s.mux.Unlock()
+			return
+		}
+		s.msgbuf = nil
+		s.mux.Unlock()
+
+		for i, pkt := range pending {
+			pending[i] = nil
+			if err == nil && s.checkPayload(pkt) == nil {
+				if e := s.sendPkt(conn, pkt); e != nil {
+					if _, ok := e.(*InterceptError); !ok {
+						err = e
+					}
+				}
+			}
+			pkt.Release()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// checkPayload returns a *ProtocolError if strict mode is enabled and the packet exceeds maxPayload
+func (s *Socket) checkPayload(pkt *Packet) error {
+	if !s.opts.Strict || s.maxPayload <= 0 {
 		return nil
 	}
-	s.status.Store(SocketClosed)
+	size := len(pkt.body)
+	if pkt.typ != BINARY {
+		size++
+	}
+	if size > s.maxPayload {
+		return &ProtocolError{fmt.Sprintf("packet size %d exceeds maxPayload %d", size, s.maxPayload)}
+	}
 	return nil
 }
 
-func (s *Socket) send(pkt *Packet) {
+// send takes the ownership of the packet, which must be acquired from AcquirePacket
+func (s *Socket) send(pkt *Packet) (err error) {
 	if s.Status() != SocketConnected {
 		s.mux.Lock()
-		defer s.mux.Unlock()
-		s.msgbuf = append(s.msgbuf, pkt)
-		return
+		// the buffer may have been flushed while waiting for the lock
+		if s.Status() != SocketConnected {
+			s.msgbuf = append(s.msgbuf, pkt)
+			buffered := len(s.msgbuf)
+			s.mux.Unlock()
+			s.checkQueue(nil, buffered)
+			return
+		}
+		s.mux.Unlock()
 	}
 
-	if err := s.sendPkt(s.Conn(), pkt); err != nil {
-		s.onClose(err)
+	defer pkt.Release()
+	s.mux.RLock()
+	conn := s.conn
+	err = s.checkPayload(pkt)
+	s.mux.RUnlock()
+	if err != nil {
+		return
+	}
+	if err = s.sendPkt(conn, pkt); err != nil {
+		if _, ok := err.(*InterceptError); !ok {
+			s.onClose(err)
+		}
+		return
 	}
+	s.checkQueue(conn, 0)
 	return
 }
 
-func (s *Socket) Emit(body []byte) {
-	s.send(&Packet{
-		typ:  MESSAGE,
-		body: body,
-	})
+// allow applies the rate limit, the wait stops when the socket is closed or the Dial context is done
+func (s *Socket) allow(size int) (bool, error) {
+	if s.limiter == nil {
+		return true, nil
+	}
+	s.mux.RLock()
+	ctx, closed := s.dialCtx, s.closed
+	s.mux.RUnlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return s.limiter.allow(ctx, closed, size)
+}
+
+// Emit sends a MESSAGE packet, body is copied so it can be reused after Emit returns.
+// It is safe to call Emit from multiple goroutines, packets are written one at a time
+// in the order they acquired the write lock. Packets emitted before the socket connected,
+// or while it is reconnecting, are buffered and flushed in order once the handshake completes
+func (s *Socket) Emit(body []byte) error {
+	if ok, err := s.allow(len(body)); !ok {
+		return err
+	}
+	if s.opts.PayloadPolicy != PayloadAllow {
+		s.mux.RLock()
+		maxPayload := s.maxPayload
+		s.mux.RUnlock()
+		if maxPayload > 0 && 1+len(body) > maxPayload {
+			if s.opts.PayloadPolicy == PayloadReject {
+				return &PayloadTooLargeError{Size: 1 + len(body), MaxPayload: maxPayload}
+			}
+			chunks, err := splitChunks(s.chunkSeq.Add(1), body, maxPayload)
+			if err != nil {
+				return err
+			}
+			for _, chunk := range chunks {
+				if err := s.send(AcquirePacket(MESSAGE, chunk)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return s.send(AcquirePacket(MESSAGE, body))
+}
+
+// EmitBinary sends data as a binary frame, or as a base64 encoded BINARY packet over text-only transports.
+// It has the same concurrency guarantees as Emit
+func (s *Socket) EmitBinary(data []byte) error {
+	if ok, err := s.allow(len(data)); !ok {
+		return err
+	}
+	return s.send(AcquirePacket(BINARY, data))
+}
+
+// SendRaw writes data as a frame without encoding it, messageType is websocket.TextMessage or websocket.BinaryMessage.
+// The frame still goes through the send interceptors and hooks, and is serialized with the other writes.
+// Unlike Emit it is not buffered, it returns ErrNotConnected if the socket is not connected
+func (s *Socket) SendRaw(messageType int, data []byte) (err error) {
+	var (
+		binary bool
+		typ    = unknownType
+	)
+	switch messageType {
+	case websocket.TextMessage:
+		if len(data) > 0 {
+			typ = pktTypeFromByte(data[0])
+		}
+	case websocket.BinaryMessage:
+		binary, typ = true, BINARY
+	default:
+		return fmt.Errorf("Engine.IO: unsupported message type %d", messageType)
+	}
+	if s.Status() != SocketConnected {
+		return ErrNotConnected
+	}
+	s.mux.RLock()
+	conn := s.conn
+	s.mux.RUnlock()
+	if err = s.sendFrame(conn, typ, binary, data); err != nil {
+		if _, ok := err.(*InterceptError); !ok {
+			s.onClose(err)
+		}
+	}
+	return
 }
@@ -0,0 +1,706 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/ahollic/socket.io/engine.io/enginetest"
+	"github.com/gorilla/websocket"
+)
+
+// accept takes over the next connection dialed through the pipe and completes the handshake
+func accept(t *testing.T, ctx context.Context, p *enginetest.Pipe) *enginetest.ServerConn {
+	t.Helper()
+	c, err := p.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open("pipe-sid", 25*time.Second, 20*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEmitBeforeDial(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, msg := range []string{"first", "second"} {
+		if err := s.Emit([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Dial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := accept(t, ctx, p)
+	for _, want := range []string{"first", "second"} {
+		pkt, err := c.RecvPacket(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Type() != engine.MESSAGE || string(pkt.Body()) != want {
+			t.Fatalf("received %s %q, want MESSAGE %q", pkt.Type(), pkt.Body(), want)
+		}
+	}
+}
+
+func TestFlushCallsBackIntoSocket(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var sid atomic.Value
+	s.OnSend(func(s *engine.Socket, _ []byte) {
+		sid.Store(s.ID())
+	})
+
+	if err := s.Emit([]byte("buffered")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := connect(t, ctx, p, s)
+	pkt, err := c.RecvPacket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pkt.Body()) != "buffered" {
+		t.Fatalf("received %q, want %q", pkt.Body(), "buffered")
+	}
+	if got := sid.Load(); got != "pipe-sid" {
+		t.Fatalf("the send hook saw ID %v, want %q", got, "pipe-sid")
+	}
+}
+
+// connect dials the socket through the pipe and waits until the handshake completed
+func connect(t *testing.T, ctx context.Context, p *enginetest.Pipe, s *engine.Socket) *enginetest.ServerConn {
+	t.Helper()
+	if err := s.Dial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := accept(t, ctx, p)
+	if err := s.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// waitState waits until the socket entered the state
+func waitState(t *testing.T, ctx context.Context, s *engine.Socket, want engine.State) {
+	t.Helper()
+	changes, stop := s.StateChanges(8)
+	defer stop()
+	for s.State() != want {
+		select {
+		case <-changes:
+		case <-ctx.Done():
+			t.Fatalf("state is %s, want %s", s.State(), want)
+		}
+	}
+}
+
+func TestDialAfterClose(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connect(t, ctx, p, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WaitClosed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := connect(t, ctx, p, s)
+	if err := s.Emit([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := c.RecvPacket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pkt.Body()) != "again" {
+		t.Fatalf("received %q on the new connection, want %q", pkt.Body(), "again")
+	}
+}
+
+func TestDialWhileConnected(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	connect(t, ctx, p, s)
+	if err := s.Dial(ctx); err != engine.ErrSocketConnected {
+		t.Fatalf("Dial returned %v while connected, want ErrSocketConnected", err)
+	}
+	if st := s.State(); st != engine.StateConnected {
+		t.Fatalf("state is %s after the rejected Dial, want %s", st, engine.StateConnected)
+	}
+}
+
+func TestDialDuringBackoff(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := connect(t, ctx, p, s)
+	c.Drop()
+	waitState(t, ctx, s, engine.StateReconnecting)
+	if err := s.Dial(ctx); err != engine.ErrSocketConnected {
+		t.Fatalf("Dial returned %v during backoff, want ErrSocketConnected", err)
+	}
+	if err := s.TriggerReconnect(); err != nil {
+		t.Fatal(err)
+	}
+	accept(t, ctx, p)
+	if err := s.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialAndWaitFailureStopsReconnect(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		// drop the connection before the handshake, so the reader schedules a reconnect
+		if c, err := p.Accept(ctx); err == nil {
+			c.Drop()
+		}
+	}()
+	dctx, dcancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer dcancel()
+	if err := s.DialAndWait(dctx); err == nil {
+		t.Fatal("DialAndWait succeeded without a handshake")
+	}
+	if st := s.State(); st != engine.StateClosed {
+		t.Fatalf("state is %s after DialAndWait failed, want %s", st, engine.StateClosed)
+	}
+	if err := s.TriggerReconnect(); err != nil {
+		t.Fatal(err)
+	}
+	actx, acancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer acancel()
+	if _, err := p.Accept(actx); err == nil {
+		t.Fatal("the socket redialed after DialAndWait failed")
+	}
+}
+
+func TestWatchdogPing(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var missed atomic.Int32
+	s.OnPingMissed(func(*engine.Socket) {
+		missed.Add(1)
+	})
+	disconnected := make(chan error, 1)
+	s.OnDisconnect(func(_ *engine.Socket, err error) {
+		select {
+		case disconnected <- err:
+		default:
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Dial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open("pipe-sid", 100*time.Millisecond, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the pings keep the connection alive beyond pingInterval + pingTimeout
+	for i := 0; i < 8; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if err := c.PingPong(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st := s.State(); st != engine.StateConnected || missed.Load() != 0 {
+		t.Fatalf("state is %s with %d missed pings while pinging, want %s", st, missed.Load(), engine.StateConnected)
+	}
+
+	// without pings the watchdog closes the connection
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, engine.ErrPingTimeout) {
+			t.Fatalf("disconnected with %v, want ErrPingTimeout", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the watchdog did not close the silent connection")
+	}
+	if missed.Load() != 1 {
+		t.Fatalf("OnPingMissed was called %d times, want 1", missed.Load())
+	}
+}
+
+func TestWatchdogGrace(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.PingGrace = 300 * time.Millisecond
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	missed := make(chan time.Time, 1)
+	s.OnPingMissed(func(*engine.Socket) {
+		missed <- time.Now()
+	})
+	disconnected := make(chan time.Time, 1)
+	s.OnDisconnect(func(*engine.Socket, error) {
+		disconnected <- time.Now()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Dial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open("pipe-sid", 50*time.Millisecond, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	var missedAt, closedAt time.Time
+	select {
+	case missedAt = <-missed:
+	case <-ctx.Done():
+		t.Fatal("OnPingMissed was not called")
+	}
+	select {
+	case closedAt = <-disconnected:
+	case <-ctx.Done():
+		t.Fatal("the watchdog did not close the connection after the grace period")
+	}
+	if d := closedAt.Sub(missedAt); d < 250*time.Millisecond {
+		t.Fatalf("the connection was closed %s after the missed ping, want at least the grace period", d)
+	}
+}
+
+func TestMaxReconnectAttempts(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.MaxReconnectAttempts = 2
+	errRefused := errors.New("refused")
+	var dials atomic.Int32
+	opts.QueryProvider = func(ctx context.Context) (url.Values, error) {
+		if dials.Add(1) > 1 {
+			return nil, errRefused
+		}
+		return nil, nil
+	}
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	failed := make(chan struct{})
+	s.OnReconnectFailed(func(*engine.Socket) {
+		close(failed)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := connect(t, ctx, p, s)
+	c.Drop()
+	for i := 0; i < 2; i++ {
+		waitState(t, ctx, s, engine.StateReconnecting)
+		if err := s.TriggerReconnect(); !errors.Is(err, errRefused) {
+			t.Fatalf("attempt %d returned %v, want the error of the query provider", i+1, err)
+		}
+	}
+	if err := s.WaitConnected(ctx); err != engine.ErrReconnectFailed {
+		t.Fatalf("WaitConnected returned %v, want ErrReconnectFailed", err)
+	}
+	if st := s.State(); st != engine.StateFailed {
+		t.Fatalf("state is %s, want %s", st, engine.StateFailed)
+	}
+	select {
+	case <-failed:
+	case <-ctx.Done():
+		t.Fatal("OnReconnectFailed was not called")
+	}
+	if n := dials.Load(); n != 3 {
+		t.Fatalf("dialed %d times, want 3", n)
+	}
+}
+
+func TestStrictRejectsSecondOpen(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.Strict = true
+	opts.DisableReconnection = true
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := connect(t, ctx, p, s)
+	if err := c.Open("pipe-sid", 25*time.Second, 20*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WaitClosed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var pe *engine.ProtocolError
+	if err := s.CloseReason(); !errors.As(err, &pe) {
+		t.Fatalf("closed with %v, want *ProtocolError", err)
+	}
+}
+
+func TestInterceptSend(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	errVeto := errors.New("veto")
+	s.InterceptSend(func(_ *engine.Socket, f engine.Frame) (engine.Frame, error) {
+		switch string(f.Data) {
+		case "4drop":
+			return f, engine.ErrDropFrame
+		case "4veto":
+			return f, errVeto
+		}
+		f.Data = bytes.ToUpper(f.Data)
+		return f, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := connect(t, ctx, p, s)
+
+	if err := s.Emit([]byte("drop")); err != nil {
+		t.Fatalf("Emit of a dropped frame returned %v", err)
+	}
+	var ie *engine.InterceptError
+	if err := s.Emit([]byte("veto")); !errors.As(err, &ie) || !errors.Is(err, errVeto) {
+		t.Fatalf("Emit of a vetoed frame returned %v, want *InterceptError", err)
+	}
+	if err := s.Emit([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := c.RecvPacket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pkt.Body()) != "HELLO" {
+		t.Fatalf("received %q, want the rewritten %q", pkt.Body(), "HELLO")
+	}
+	if st := s.State(); st != engine.StateConnected {
+		t.Fatalf("state is %s after the vetoed frame, want %s", st, engine.StateConnected)
+	}
+}
+
+func TestResetBackoffDelay(t *testing.T) {
+	p := enginetest.NewPipe()
+	s, err := engine.NewSocket(p.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	delays := make(chan time.Duration, 1)
+	s.OnReconnectAttempt(func(_ *engine.Socket, attempt *engine.ReconnectAttempt) {
+		select {
+		case delays <- attempt.Delay:
+		default:
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := connect(t, ctx, p, s)
+	c.Drop()
+	waitState(t, ctx, s, engine.StateReconnecting)
+	s.ResetBackoff()
+	select {
+	case d := <-delays:
+		if d != time.Second {
+			t.Fatalf("the first attempt after ResetBackoff was delayed by %s, want %s", d, time.Second)
+		}
+	case <-ctx.Done():
+		t.Fatal("no reconnect attempt")
+	}
+	accept(t, ctx, p)
+}
+
+func TestTriggerReconnectRecoversPanic(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	dialed := 0
+	opts.QueryProvider = func(ctx context.Context) (url.Values, error) {
+		if dialed++; dialed > 1 {
+			panic("query provider failed")
+		}
+		return nil, nil
+	}
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	panicked := make(chan *engine.HandlerPanicError, 1)
+	s.OnHandlerPanic(func(_ *engine.Socket, err *engine.HandlerPanicError) {
+		select {
+		case panicked <- err:
+		default:
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := connect(t, ctx, p, s)
+	c.Drop()
+	waitState(t, ctx, s, engine.StateReconnecting)
+	s.TriggerReconnect()
+	select {
+	case err := <-panicked:
+		if err.Value != "query provider failed" {
+			t.Fatalf("unexpected panic value %v", err.Value)
+		}
+	case <-ctx.Done():
+		t.Fatal("the panic of the reconnect was not reported")
+	}
+}
+
+// newCountServer starts a websocket server which counts and discards the received MESSAGE packets
+func newCountServer(b *testing.B, received *atomic.Int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(rw, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"bench","upgrades":[],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`))
+		for {
+			_, r, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+			var typ [1]byte
+			if n, _ := r.Read(typ[:]); n == 1 && typ[0] == engine.MESSAGE.ID() {
+				received.Add(1)
+			}
+		}
+	}))
+	b.Cleanup(srv.Close)
+	return srv
+}
+
+// BenchmarkEmit measures the throughput of small messages sent over a websocket connection
+func BenchmarkEmit(b *testing.B) {
+	for _, size := range []int{32, 1024} {
+		for _, mode := range []struct {
+			name     string
+			zeroCopy bool
+			flush    time.Duration
+		}{
+			{"Default", false, 0},
+			{"ZeroCopy", true, 0},
+			{"Flush", false, time.Millisecond},
+			{"ZeroCopyFlush", true, time.Millisecond},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", mode.name, size), func(b *testing.B) {
+				var received atomic.Int64
+				srv := newCountServer(b, &received)
+				s, err := engine.NewSocket(engine.Options{
+					Host:          srv.Listener.Addr().String(),
+					Path:          "/",
+					ZeroCopy:      mode.zeroCopy,
+					FlushInterval: mode.flush,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer s.Close()
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if err := s.DialAndWait(ctx); err != nil {
+					b.Fatal(err)
+				}
+
+				msg := bytes.Repeat([]byte{'x'}, size)
+				b.SetBytes((int64)(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := s.Emit(msg); err != nil {
+						b.Fatal(err)
+					}
+				}
+				for received.Load() < (int64)(b.N) {
+					if ctx.Err() != nil {
+						b.Fatalf("received %d of %d messages", received.Load(), b.N)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			})
+		}
+	}
+}
+
+func TestRateLimitWaitStopsOnClose(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.RateLimit = &engine.RateLimit{
+		Packets:     0.1,
+		PacketBurst: 1,
+		Policy:      engine.RateLimitWait,
+	}
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Emit([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Emit([]byte("second"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+	select {
+	case err := <-done:
+		if err != engine.ErrNotConnected {
+			t.Fatalf("Emit returned %v after Close, want ErrNotConnected", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Emit kept waiting for the rate limit after Close")
+	}
+}
+
+func TestRateLimitDropReturnsError(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.RateLimit = &engine.RateLimit{
+		Packets:     0.1,
+		PacketBurst: 1,
+		Policy:      engine.RateLimitDrop,
+	}
+	s, err := engine.NewSocket(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Emit([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Emit([]byte("second")); !errors.Is(err, engine.ErrRateLimited) || err != engine.ErrRateLimitDropped {
+		t.Fatalf("Emit returned %v for a dropped packet, want ErrRateLimitDropped", err)
+	}
+}
+
+func TestPoolReplacesClosedSocket(t *testing.T) {
+	p := enginetest.NewPipe()
+	opts := p.Options()
+	opts.DisableReconnection = true
+	pool, err := engine.NewPool(opts, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pool.Dial(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := accept(t, ctx, p)
+	accept(t, ctx, p)
+	old := pool.Sockets()
+
+	first.Drop()
+	accept(t, ctx, p)
+	for {
+		replaced := 0
+		for i, s := range pool.Sockets() {
+			if s != old[i] {
+				replaced++
+			}
+		}
+		if replaced == 1 {
+			break
+		} else if replaced > 1 {
+			t.Fatalf("%d sockets were replaced, want 1", replaced)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("the closed socket was not replaced")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
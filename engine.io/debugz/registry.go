@@ -0,0 +1,197 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package debugz
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+// MaxRecentErrors is the number of errors kept for each socket
+const MaxRecentErrors = 16
+
+// ErrorRecord is an error reported by a socket
+type ErrorRecord struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// SocketInfo is the state of a tracked socket
+type SocketInfo struct {
+	ID        uint64        `json:"id"`
+	Name      string        `json:"name,omitempty"`
+	Sid       string        `json:"sid"`
+	Status    string        `json:"status"`
+	State     engine.State  `json:"state"`
+	URL       string        `json:"url"`
+	Transport string        `json:"transport"`
+	Stats     engine.Stats  `json:"stats"`
+	Errors    []ErrorRecord `json:"errors"`
+}
+
+func statusName(st engine.SocketStatus) string {
+	switch st {
+	case engine.SocketClosed:
+		return "closed"
+	case engine.SocketOpening:
+		return "opening"
+	case engine.SocketConnected:
+		return "connected"
+	case engine.SocketFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+type entry struct {
+	id      uint64
+	name    string
+	socket  *engine.Socket
+	tracked atomic.Bool
+
+	mux    sync.Mutex
+	errors []ErrorRecord
+}
+
+func (e *entry) addError(err error) {
+	if err == nil || !e.tracked.Load() {
+		return
+	}
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if len(e.errors) >= MaxRecentErrors {
+		copy(e.errors, e.errors[1:])
+		e.errors = e.errors[:len(e.errors)-1]
+	}
+	e.errors = append(e.errors, ErrorRecord{
+		Time:  time.Now(),
+		Error: err.Error(),
+	})
+}
+
+func (e *entry) info() SocketInfo {
+	s := e.socket
+	e.mux.Lock()
+	errors := append(([]ErrorRecord)(nil), e.errors...)
+	e.mux.Unlock()
+	return SocketInfo{
+		ID:        e.id,
+		Name:      e.name,
+		Sid:       s.ID(),
+		Status:    statusName(s.Status()),
+		State:     s.State(),
+		URL:       s.URL().String(),
+		Transport: s.Transport(),
+		Stats:     s.Stats(),
+		Errors:    errors,
+	}
+}
+
+// Registry holds the tracked sockets
+type Registry struct {
+	mux     sync.RWMutex
+	nextId  uint64
+	entries map[uint64]*entry
+}
+
+// Default is the registry used by the package level functions
+var Default = new(Registry)
+
+// Track adds the socket to the registry until untrack is called,
+// name is an optional label shown in the listing
+func (r *Registry) Track(s *engine.Socket, name string) (untrack func()) {
+	r.mux.Lock()
+	if r.entries == nil {
+		r.entries = make(map[uint64]*entry)
+	}
+	r.nextId++
+	e := &entry{
+		id:     r.nextId,
+		name:   name,
+		socket: s,
+	}
+	e.tracked.Store(true)
+	r.entries[e.id] = e
+	r.mux.Unlock()
+
+	s.OnDisconnect(func(_ *engine.Socket, err error) {
+		e.addError(err)
+	})
+	s.OnDialError(func(_ *engine.Socket, ctx *engine.DialErrorContext) {
+		e.addError(ctx.Err())
+	})
+	return func() {
+		e.tracked.Store(false)
+		r.mux.Lock()
+		delete(r.entries, e.id)
+		r.mux.Unlock()
+	}
+}
+
+// Sockets returns the state of all tracked sockets ordered by the time they were tracked
+func (r *Registry) Sockets() []SocketInfo {
+	r.mux.RLock()
+	entries := make([]*entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	r.mux.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+	infos := make([]SocketInfo, len(entries))
+	for i, e := range entries {
+		infos[i] = e.info()
+	}
+	return infos
+}
+
+// ServeHTTP responds the tracked sockets as JSON
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	enc.Encode(r.Sockets())
+}
+
+// Publish exports the tracked sockets as an expvar variable.
+// Like expvar.Publish, it panics if the name is already used
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Sockets()
+	}))
+}
+
+// Track adds the socket to the Default registry
+func Track(s *engine.Socket, name string) (untrack func()) {
+	return Default.Track(s, name)
+}
+
+// Handler returns the HTTP handler of the Default registry
+func Handler() http.Handler {
+	return Default
+}
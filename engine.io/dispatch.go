@@ -0,0 +1,94 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"runtime"
+)
+
+type DispatchMode int
+
+const (
+	// DispatchSync calls the handlers on the reader goroutine
+	DispatchSync DispatchMode = iota
+	// DispatchOrdered calls the handlers on a dedicated goroutine in the order the packets were received
+	DispatchOrdered
+	// DispatchPool calls the handlers on a pool of goroutines, the order is not guaranteed.
+	// Only use it when the messages are independent of each other, see Options.Dispatch
+	DispatchPool
+)
+
+const defaultDispatchQueueSize = 256
+
+// dispatcher runs the message and binary handlers of a connection
+type dispatcher struct {
+	queue   chan func()
+	protect func(fn func()) bool
+}
+
+func newDispatcher(opts *Options, protect func(fn func()) bool) *dispatcher {
+	var workers int
+	switch opts.Dispatch {
+	case DispatchOrdered:
+		workers = 1
+	case DispatchPool:
+		if workers = opts.DispatchWorkers; workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+	default:
+		return nil
+	}
+	size := opts.DispatchQueueSize
+	if size <= 0 {
+		size = defaultDispatchQueueSize
+	}
+	d := &dispatcher{
+		queue:   make(chan func(), size),
+		protect: protect,
+	}
+	for i := 0; i < workers; i++ {
+		go d.worker()
+	}
+	return d
+}
+
+func (d *dispatcher) worker() {
+	for fn := range d.queue {
+		d.protect(fn)
+	}
+}
+
+// dispatch queues fn, it blocks when the queue is full.
+// fn is called directly if d is nil
+func (d *dispatcher) dispatch(fn func()) {
+	if d == nil {
+		fn()
+		return
+	}
+	d.queue <- fn
+}
+
+// stop lets the workers exit after the queued handlers finished
+func (d *dispatcher) stop() {
+	if d == nil {
+		return
+	}
+	close(d.queue)
+}
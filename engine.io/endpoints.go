@@ -0,0 +1,165 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+type EndpointStrategy int
+
+const (
+	// EndpointPriority tries the endpoints in the order they were given
+	EndpointPriority EndpointStrategy = iota
+	// EndpointRoundRobin starts from the next endpoint on every dial
+	EndpointRoundRobin
+	// EndpointRandom tries the endpoints in a random order
+	EndpointRandom
+)
+
+// Endpoints is a list of server hosts used by Options.Endpoints.
+// Healthy endpoints are tried by the strategy first, an endpoint becomes unhealthy after
+// MaxFailures consecutive dial failures and stays unhealthy for Cooldown.
+// Unhealthy endpoints are only tried when all healthy ones failed
+type Endpoints struct {
+	Strategy EndpointStrategy
+	// MaxFailures default is 1
+	MaxFailures int
+	// Cooldown default is 30s
+	Cooldown time.Duration
+
+	mux       sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+type endpoint struct {
+	host      string
+	failures  int
+	lastErr   error
+	downUntil time.Time
+}
+
+// EndpointHealth is a snapshot of the state of an endpoint
+type EndpointHealth struct {
+	Host      string
+	Healthy   bool
+	Failures  int
+	LastError error
+}
+
+// NewEndpoints creates Endpoints with the hosts in the same format as Options.Host
+func NewEndpoints(strategy EndpointStrategy, hosts ...string) *Endpoints {
+	e := &Endpoints{
+		Strategy:  strategy,
+		endpoints: make([]*endpoint, len(hosts)),
+	}
+	for i, h := range hosts {
+		e.endpoints[i] = &endpoint{host: h}
+	}
+	return e
+}
+
+// Health returns the state of all endpoints in the order they were given
+func (e *Endpoints) Health() []EndpointHealth {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	now := time.Now()
+	res := make([]EndpointHealth, len(e.endpoints))
+	for i, ep := range e.endpoints {
+		res[i] = EndpointHealth{
+			Host:      ep.host,
+			Healthy:   !now.Before(ep.downUntil),
+			Failures:  ep.failures,
+			LastError: ep.lastErr,
+		}
+	}
+	return res
+}
+
+// candidates returns the hosts in the order they should be tried
+func (e *Endpoints) candidates() []string {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	n := len(e.endpoints)
+	ordered := make([]*endpoint, n)
+	switch e.Strategy {
+	case EndpointRoundRobin:
+		for i := range ordered {
+			ordered[i] = e.endpoints[(e.next+i)%n]
+		}
+		if n > 0 {
+			e.next = (e.next + 1) % n
+		}
+	case EndpointRandom:
+		for i, j := range rand.Perm(n) {
+			ordered[i] = e.endpoints[j]
+		}
+	default:
+		copy(ordered, e.endpoints)
+	}
+	now := time.Now()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i].downUntil, ordered[j].downUntil
+		if !now.Before(a) {
+			return now.Before(b)
+		}
+		return now.Before(b) && a.Before(b)
+	})
+	hosts := make([]string, n)
+	for i, ep := range ordered {
+		hosts[i] = ep.host
+	}
+	return hosts
+}
+
+func (e *Endpoints) report(host string, err error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	for _, ep := range e.endpoints {
+		if ep.host != host {
+			continue
+		}
+		if err == nil {
+			ep.failures = 0
+			ep.lastErr = nil
+			ep.downUntil = time.Time{}
+			return
+		}
+		ep.failures++
+		ep.lastErr = err
+		maxFailures := e.MaxFailures
+		if maxFailures <= 0 {
+			maxFailures = 1
+		}
+		if ep.failures >= maxFailures {
+			cooldown := e.Cooldown
+			if cooldown <= 0 {
+				cooldown = 30 * time.Second
+			}
+			ep.downUntil = time.Now().Add(cooldown)
+		}
+		return
+	}
+}
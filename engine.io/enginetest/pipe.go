@@ -0,0 +1,291 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package enginetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+const PipeTransport = "pipe"
+
+var errBinaryFrame = errors.New("enginetest: received a binary frame")
+
+type frame struct {
+	binary bool
+	data   []byte
+}
+
+type pipe struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (p *pipe) close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+}
+
+type pipeEnd struct {
+	*pipe
+	in  <-chan frame
+	out chan<- frame
+}
+
+func (e *pipeEnd) read(ctx context.Context) (f frame, err error) {
+	select {
+	case f = <-e.in:
+		return
+	default:
+	}
+	select {
+	case f = <-e.in:
+		return
+	case <-e.closed:
+		return f, io.ErrClosedPipe
+	case <-ctx.Done():
+		return f, ctx.Err()
+	}
+}
+
+func (e *pipeEnd) write(binary bool, data []byte) error {
+	f := frame{
+		binary: binary,
+		data:   append(make([]byte, 0, len(data)), data...),
+	}
+	select {
+	case <-e.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case e.out <- f:
+		return nil
+	case <-e.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+type clientConn struct {
+	pipeEnd
+}
+
+var _ engine.Conn = (*clientConn)(nil)
+
+func (c *clientConn) ReadFrame(buf []byte) (binary bool, data []byte, err error) {
+	f, err := c.read(context.Background())
+	if err != nil {
+		return false, buf[:0], err
+	}
+	return f.binary, append(buf[:0], f.data...), nil
+}
+
+func (c *clientConn) WriteFrame(binary bool, data []byte) error {
+	return c.write(binary, data)
+}
+
+func (c *clientConn) Close() error {
+	c.close()
+	return nil
+}
+
+// Pipe is an in-memory engine.Transport.
+// Every dialed connection can be taken over by Accept on the server side
+type Pipe struct {
+	// BufferSize is the number of frames can be buffered in each direction
+	BufferSize int
+
+	conns chan *ServerConn
+}
+
+var _ engine.Transport = (*Pipe)(nil)
+
+func NewPipe() *Pipe {
+	return &Pipe{
+		BufferSize: 64,
+		conns:      make(chan *ServerConn, 16),
+	}
+}
+
+func (p *Pipe) Name() string {
+	return PipeTransport
+}
+
+// Options returns engine options that dial through this pipe only
+func (p *Pipe) Options() engine.Options {
+	return engine.Options{
+		Host:       PipeTransport,
+		Path:       "/engine.io/",
+		Transports: []string{PipeTransport},
+		CustomTransports: map[string]engine.Transport{
+			PipeTransport: p,
+		},
+	}
+}
+
+func (p *Pipe) Dial(ctx context.Context, _ *engine.Socket, u *url.URL) (engine.Conn, error) {
+	shared := &pipe{
+		closed: make(chan struct{}),
+	}
+	c2s := make(chan frame, p.BufferSize)
+	s2c := make(chan frame, p.BufferSize)
+	u2 := *u
+	server := &ServerConn{
+		URL: &u2,
+		pipeEnd: pipeEnd{
+			pipe: shared,
+			in:   c2s,
+			out:  s2c,
+		},
+	}
+	select {
+	case p.conns <- server:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &clientConn{
+		pipeEnd: pipeEnd{
+			pipe: shared,
+			in:   s2c,
+			out:  c2s,
+		},
+	}, nil
+}
+
+// Accept waits for the next dialed connection
+func (p *Pipe) Accept(ctx context.Context) (*ServerConn, error) {
+	select {
+	case c := <-p.conns:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ServerConn is the server side of a dialed pipe connection,
+// nothing will be sent to the client unless it's explicitly called
+type ServerConn struct {
+	// URL is the URL the client dialed
+	URL *url.URL
+
+	pipeEnd
+}
+
+// Open sends the OPEN packet with given handshake parameters
+func (c *ServerConn) Open(sid string, pingInterval, pingTimeout time.Duration) error {
+	body, err := json.Marshal(map[string]any{
+		"sid":          sid,
+		"upgrades":     []string{},
+		"pingInterval": pingInterval.Milliseconds(),
+		"pingTimeout":  pingTimeout.Milliseconds(),
+		"maxPayload":   1000000,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Send(engine.OPEN, body)
+}
+
+// Send sends a text packet
+func (c *ServerConn) Send(typ engine.PacketType, body []byte) error {
+	data := make([]byte, 1+len(body))
+	data[0] = typ.ID()
+	copy(data[1:], body)
+	return c.write(false, data)
+}
+
+// Ping sends a PING packet, the client replies with a PONG.
+// Since the server never pings by itself, the tests control the heartbeat seen by the watchdog of the client
+func (c *ServerConn) Ping() error {
+	return c.Send(engine.PING, nil)
+}
+
+// PingPong sends a PING packet and waits for the PONG of the client,
+// it fails if the client sent any other frame first
+func (c *ServerConn) PingPong(ctx context.Context) error {
+	if err := c.Ping(); err != nil {
+		return err
+	}
+	pkt, err := c.RecvPacket(ctx)
+	if err != nil {
+		return err
+	}
+	if pkt.Type() != engine.PONG {
+		return fmt.Errorf("enginetest: received %s packet, want PONG", pkt.Type())
+	}
+	return nil
+}
+
+func (c *ServerConn) SendMessage(body []byte) error {
+	return c.Send(engine.MESSAGE, body)
+}
+
+// SendBinary sends a binary frame
+func (c *ServerConn) SendBinary(data []byte) error {
+	return c.write(true, data)
+}
+
+// Recv waits for the next raw frame sent by the client
+func (c *ServerConn) Recv(ctx context.Context) (binary bool, data []byte, err error) {
+	f, err := c.read(ctx)
+	return f.binary, f.data, err
+}
+
+// RecvPacket waits for the next text frame and decodes it
+func (c *ServerConn) RecvPacket(ctx context.Context) (*engine.Packet, error) {
+	f, err := c.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if f.binary {
+		return nil, errBinaryFrame
+	}
+	pkt := new(engine.Packet)
+	if err := pkt.UnmarshalBinary(f.data); err != nil {
+		return nil, err
+	}
+	return pkt, nil
+}
+
+// Close sends a CLOSE packet and then closes the pipe
+func (c *ServerConn) Close() error {
+	err := c.Send(engine.CLOSE, nil)
+	c.close()
+	return err
+}
+
+// Drop closes the pipe without sending any packet, as if the network went down
+func (c *ServerConn) Drop() {
+	c.close()
+}
+
+// Closed returns a channel which will be closed when any side closed the pipe
+func (c *ServerConn) Closed() <-chan struct{} {
+	return c.closed
+}
@@ -0,0 +1,168 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DialError is reported when the transport failed to connect to the server
+type DialError struct {
+	Transport string
+	Err       error
+}
+
+var _ error = (*DialError)(nil)
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("Engine.IO: dial %s: %v", e.Transport, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseError is reported when the server responded the dial or polling request with an unexpected status.
+// The body of Response is already closed, the first maxErrorBodySize bytes of it are kept in Body
+type ResponseError struct {
+	Response *http.Response
+	Body     []byte
+	Err      error
+}
+
+var _ error = (*ResponseError)(nil)
+
+const maxErrorBodySize = 64 * 1024
+
+func newResponseError(resp *http.Response, err error) *ResponseError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	return &ResponseError{
+		Response: resp,
+		Body:     body,
+		Err:      err,
+	}
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("Engine.IO: %s: %s", strings.TrimPrefix(e.Err.Error(), "Engine.IO: "), e.Response.Status)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the status code of the response
+func (e *ResponseError) StatusCode() int {
+	return e.Response.StatusCode
+}
+
+// ReadLimitError is reported when a received frame or polling response exceeds the read limit,
+// see Options.ReadLimit
+type ReadLimitError struct {
+	Limit int64
+}
+
+var _ error = (*ReadLimitError)(nil)
+
+func (e *ReadLimitError) Error() string {
+	return fmt.Sprintf("Engine.IO: received message exceeds read limit %d", e.Limit)
+}
+
+// HandshakeError is reported when the server sent an invalid OPEN packet
+type HandshakeError struct {
+	Err error
+}
+
+var _ error = (*HandshakeError)(nil)
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("Engine.IO: handshake failed: %v", e.Err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// ProtocolError is reported when the peer or the caller violated the Engine.IO protocol
+type ProtocolError struct {
+	Reason string
+}
+
+var _ error = (*ProtocolError)(nil)
+
+func (e *ProtocolError) Error() string {
+	return "Engine.IO: protocol error: " + e.Reason
+}
+
+// TimeoutError is reported when the server did not respond in time
+type TimeoutError struct {
+	Err error
+}
+
+var _ error = (*TimeoutError)(nil)
+
+func (e *TimeoutError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// HandlerPanicError is reported when a callback panicked
+type HandlerPanicError struct {
+	Value any
+	Stack []byte
+}
+
+var _ error = (*HandlerPanicError)(nil)
+
+func (e *HandlerPanicError) Error() string {
+	return fmt.Sprintf("Engine.IO: callback panicked: %v", e.Value)
+}
+
+// ServerCloseError is reported when the server closed the connection.
+// Code and Reason are the websocket close code and text, or zero values if unknown
+type ServerCloseError struct {
+	Code   int
+	Reason string
+	Err    error
+}
+
+var _ error = (*ServerCloseError)(nil)
+
+func (e *ServerCloseError) Error() string {
+	if e.Code == 0 && e.Reason == "" {
+		return "Engine.IO: server closed the connection"
+	}
+	return fmt.Sprintf("Engine.IO: server closed the connection (%d): %s", e.Code, e.Reason)
+}
+
+func (e *ServerCloseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,92 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDropFrame can be returned by an Interceptor to drop the frame silently
+var ErrDropFrame = errors.New("Engine.IO: frame dropped by interceptor")
+
+// Interceptor rewrites a frame, it returns the frame to continue with.
+// Interceptors run in the order they were added, until one of them returns an error
+type Interceptor func(s *Socket, frame Frame) (Frame, error)
+
+// InterceptError is returned by the send methods when an interceptor vetoed the frame
+type InterceptError struct {
+	Err error
+}
+
+var _ error = (*InterceptError)(nil)
+
+func (e *InterceptError) Error() string {
+	return fmt.Sprintf("Engine.IO: frame vetoed by interceptor: %v", e.Err)
+}
+
+func (e *InterceptError) Unwrap() error {
+	return e.Err
+}
+
+type interceptorChain struct {
+	mux  sync.RWMutex
+	list []Interceptor
+}
+
+func (c *interceptorChain) add(i Interceptor) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.list = append(c.list, i)
+}
+
+func (c *interceptorChain) len() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return len(c.list)
+}
+
+func (c *interceptorChain) run(s *Socket, frame Frame) (Frame, error) {
+	c.mux.RLock()
+	list := c.list
+	c.mux.RUnlock()
+	var err error
+	for _, i := range list {
+		if frame, err = i(s, frame); err != nil {
+			return frame, err
+		}
+	}
+	return frame, nil
+}
+
+// InterceptSend adds the interceptor of the frames before they are written to the transport.
+// It runs after the packets were encoded, and before the OnSend callbacks.
+// If it returns ErrDropFrame the frame is not sent, other errors are returned as *InterceptError
+func (s *Socket) InterceptSend(i Interceptor) {
+	s.sendInterceptors.add(i)
+}
+
+// InterceptRecv adds the interceptor of the frames read from the transport.
+// It runs after the OnRecvFrame callbacks, and before the frames are decoded.
+// If it returns ErrDropFrame the frame is ignored, other errors close the connection
+func (s *Socket) InterceptRecv(i Interceptor) {
+	s.recvInterceptors.add(i)
+}
@@ -0,0 +1,98 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"net"
+	"sort"
+)
+
+type IPPreference int
+
+const (
+	// IPDefault uses the Happy Eyeballs behaviour of net.Dialer
+	IPDefault IPPreference = iota
+	IPv4Only
+	IPv6Only
+	// IPv4First tries all IPv4 addresses before any IPv6 address
+	IPv4First
+	// IPv6First tries all IPv6 addresses before any IPv4 address
+	IPv6First
+)
+
+// netDialFunc returns the dial function of the builtin transports,
+// or nil if the default one should be used
+func (s *Socket) netDialFunc() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if s.opts.NetDialContext != nil {
+		return s.opts.NetDialContext
+	}
+	if s.opts.NetDialer == nil && s.opts.IPPreference == IPDefault {
+		return nil
+	}
+	d := s.opts.NetDialer
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	pref := s.opts.IPPreference
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		switch pref {
+		case IPv4Only:
+			network = "tcp4"
+		case IPv6Only:
+			network = "tcp6"
+		case IPv4First, IPv6First:
+			return dialPreferred(ctx, d, network, addr, pref == IPv4First)
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// dialPreferred dials the resolved addresses one by one with the preferred family first,
+// so d.Timeout limits every single attempt
+func dialPreferred(ctx context.Context, d *net.Dialer, network, addr string, v4 bool) (conn net.Conn, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	if net.ParseIP(host) != nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return (addrs[i].IP.To4() != nil) == v4 && (addrs[j].IP.To4() != nil) != v4
+	})
+	for _, a := range addrs {
+		if conn, err = d.DialContext(ctx, network, net.JoinHostPort(a.IP.String(), port)); err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	return
+}
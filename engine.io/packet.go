@@ -24,15 +24,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 )
 
 type UnexpectedPacketTypeError struct {
 	Type PacketType
+	// Byte is the raw type byte of a decoded packet, Type is -1 in that case
+	Byte byte
 }
 
 var _ error = (*UnexpectedPacketTypeError)(nil)
 
 func (e *UnexpectedPacketTypeError) Error() string {
+	if e.Type == unknownType {
+		return fmt.Sprintf("Unexpected packet type %q", e.Byte)
+	}
 	return fmt.Sprintf("Unexpected packet type %d", e.Type)
 }
 
@@ -74,26 +80,39 @@ func (t PacketType) String() string {
 	return fmt.Sprintf("PacketType(%d)", (int8)(t))
 }
 
+func (t PacketType) MarshalText() ([]byte, error) {
+	return ([]byte)(t.String()), nil
+}
+
+// ID returns the byte which prefixes the packet in its text form, it panics if t is not a known type
 func (t PacketType) ID() byte {
+	id, ok := t.id()
+	if !ok {
+		panic(&UnexpectedPacketTypeError{Type: t})
+	}
+	return id
+}
+
+func (t PacketType) id() (byte, bool) {
 	switch t {
 	case OPEN:
-		return '0'
+		return '0', true
 	case CLOSE:
-		return '1'
+		return '1', true
 	case PING:
-		return '2'
+		return '2', true
 	case PONG:
-		return '3'
+		return '3', true
 	case MESSAGE:
-		return '4'
+		return '4', true
 	case UPGRADE:
-		return '5'
+		return '5', true
 	case NOOP:
-		return '6'
+		return '6', true
 	case BINARY:
-		return 'b'
+		return 'b', true
 	}
-	panic(&UnexpectedPacketTypeError{t})
+	return 0, false
 }
 
 func pktTypeFromByte(id byte) PacketType {
@@ -118,11 +137,56 @@ func pktTypeFromByte(id byte) PacketType {
 	return unknownType
 }
 
+// Packet is an Engine.IO packet, its text form is the ID of the type followed by the body,
+// e.g. "4hello" is a MESSAGE packet with the body "hello".
+// The body of a BINARY packet is base64 encoded in the text form, e.g. "bAQID",
+// which is how binary data is carried by the polling transport
 type Packet struct {
 	typ  PacketType
 	body []byte
 }
 
+// NewPacket returns a packet of the type and the body, the body is not copied
+func NewPacket(typ PacketType, body []byte) *Packet {
+	return &Packet{
+		typ:  typ,
+		body: body,
+	}
+}
+
+var packetPool = sync.Pool{
+	New: func() any {
+		return new(Packet)
+	},
+}
+
+// AcquirePacket gets a packet from the pool and copies body into it.
+// The packet should be given back by Release once it is no longer used
+func AcquirePacket(typ PacketType, body []byte) *Packet {
+	p := packetPool.Get().(*Packet)
+	p.typ = typ
+	p.body = append(p.body[:0], body...)
+	return p
+}
+
+// Release puts the packet back to the pool,
+// neither the packet nor its body can be used after released
+func (p *Packet) Release() {
+	if cap(p.body) > maxPooledBufferSize {
+		p.body = nil
+	}
+	packetPool.Put(p)
+}
+
+// Clone returns a copy of the packet which does not share the body
+func (p *Packet) Clone() *Packet {
+	return &Packet{
+		typ:  p.typ,
+		body: append(([]byte)(nil), p.body...),
+	}
+}
+
+// Type returns the type of the packet
 func (p *Packet) Type() PacketType {
 	return p.typ
 }
@@ -131,25 +195,62 @@ func (p *Packet) String() string {
 	return fmt.Sprintf("Packet(%s, <%d bytes>)", p.typ.String(), len(p.body))
 }
 
+// Body returns the body of the packet, which is decoded if it is a BINARY packet.
+// It is not copied, the body of a pooled packet cannot be used after released
 func (p *Packet) Body() []byte {
 	return p.body
 }
 
+// SetBody replaces the body of the packet, the body is not copied
 func (p *Packet) SetBody(body []byte) {
 	p.body = body
 }
 
+// UnmarshalBody decodes the JSON body into ptr, e.g. the handshake of an OPEN packet
 func (p *Packet) UnmarshalBody(ptr any) error {
 	return json.Unmarshal(p.body, &ptr)
 }
 
+// MarshalBinary encodes the packet to its text form,
+// the body of a BINARY packet is encoded as base64.
+// It returns *UnexpectedPacketTypeError if the type is unknown
 func (p *Packet) MarshalBinary() (data []byte, err error) {
-	data = make([]byte, 1+len(p.body))
-	data[0] = p.typ.ID()
-	copy(data[1:], p.body)
-	return
+	size := 1 + len(p.body)
+	if p.typ == BINARY {
+		size = 1 + base64.StdEncoding.EncodedLen(len(p.body))
+	}
+	return p.AppendBinary(make([]byte, 0, size))
 }
 
+// AppendBinary appends the text form of the packet to dst, see MarshalBinary
+func (p *Packet) AppendBinary(dst []byte) (data []byte, err error) {
+	id, ok := p.typ.id()
+	if !ok {
+		return dst, &UnexpectedPacketTypeError{Type: p.typ}
+	}
+	data = append(dst, id)
+	if p.typ == BINARY {
+		n := len(data)
+		data = append(data, make([]byte, base64.StdEncoding.EncodedLen(len(p.body)))...)
+		base64.StdEncoding.Encode(data[n:], p.body)
+		return data, nil
+	}
+	return append(data, p.body...), nil
+}
+
+// ParsePacket decodes a packet from its text form without modifying data.
+// Malformed input from an untrusted server only results an error, so it is safe to be used as a fuzz target
+func ParsePacket(data []byte) (*Packet, error) {
+	p := new(Packet)
+	if err := p.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UnmarshalBinary decodes the text form of a packet, data is not modified.
+// It returns io.EOF if data is empty, *UnexpectedPacketTypeError if the type is unknown,
+// or the base64 error if the body of a BINARY packet is malformed
 func (p *Packet) UnmarshalBinary(data []byte) error {
 	if len(data) == 0 {
 		return io.EOF
@@ -157,18 +258,25 @@ func (p *Packet) UnmarshalBinary(data []byte) error {
 
 	typ := pktTypeFromByte(data[0])
 	if typ == unknownType {
-		return &UnexpectedPacketTypeError{typ}
+		return &UnexpectedPacketTypeError{Type: typ, Byte: data[0]}
 	}
-	p.typ = typ
+	data = data[1:]
 	if typ == BINARY {
-		n, err := base64.StdEncoding.Decode(data, data[1:])
+		// reuse buffer if possible
+		body := p.body[:0]
+		if size := base64.StdEncoding.DecodedLen(len(data)); cap(body) < size {
+			body = make([]byte, size)
+		} else {
+			body = body[:size]
+		}
+		n, err := base64.StdEncoding.Decode(body, data)
 		if err != nil {
 			return err
 		}
-		data = data[:n]
-	} else {
-		data = data[1:]
+		p.typ, p.body = typ, body[:n]
+		return nil
 	}
+	p.typ = typ
 	// reuse buffer if possible
 	p.body = append(p.body[:0], data...)
 	return nil
@@ -0,0 +1,104 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package engine_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+func TestParsePacketUnknownType(t *testing.T) {
+	_, err := engine.ParsePacket([]byte("9hello"))
+	var ue *engine.UnexpectedPacketTypeError
+	if !errors.As(err, &ue) {
+		t.Fatalf("ParsePacket returned %v, want *UnexpectedPacketTypeError", err)
+	}
+	if ue.Byte != '9' {
+		t.Errorf("the error reports byte %q, want '9'", ue.Byte)
+	}
+	if want := `Unexpected packet type '9'`; err.Error() != want {
+		t.Errorf("the error message is %q, want %q", err.Error(), want)
+	}
+}
+
+func FuzzParsePacket(f *testing.F) {
+	for _, seed := range []string{
+		`0{"sid":"abc","upgrades":["websocket"],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`,
+		"1",
+		"2probe",
+		"3",
+		"4hello",
+		"4\x1f1,0,2,hé",
+		"5",
+		"6",
+		"bAQID",
+		"b!!",
+		"9",
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		orig := bytes.Clone(data)
+		pkt, err := engine.ParsePacket(data)
+		if !bytes.Equal(data, orig) {
+			t.Fatalf("ParsePacket modified its input %q to %q", orig, data)
+		}
+		if err != nil {
+			return
+		}
+		buf, err := pkt.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal parsed packet %s: %v", pkt, err)
+		}
+		pkt2, err := engine.ParsePacket(buf)
+		if err != nil {
+			t.Fatalf("failed to parse marshaled packet %q: %v", buf, err)
+		}
+		if pkt2.Type() != pkt.Type() || !bytes.Equal(pkt2.Body(), pkt.Body()) {
+			t.Fatalf("round trip of %q changed %s to %s", data, pkt, pkt2)
+		}
+	})
+}
+
+// BenchmarkPacketEncode compares MarshalBinary with AppendBinary into a reused buffer, which ZeroCopy uses
+func BenchmarkPacketEncode(b *testing.B) {
+	pkt := engine.NewPacket(engine.MESSAGE, bytes.Repeat([]byte{'x'}, 32))
+	b.Run("MarshalBinary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := pkt.MarshalBinary(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("AppendBinary", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			var err error
+			if buf, err = pkt.AppendBinary(buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
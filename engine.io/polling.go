@@ -0,0 +1,358 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pollingCloseTimeout is how long Close waits for the queued frames
+const pollingCloseTimeout = 3 * time.Second
+
+// payloadSeparator separates the packets inside a polling payload
+const payloadSeparator = '\x1e'
+
+var (
+	errPollingHandshake = &HandshakeError{errors.New("polling handshake did not respond with an OPEN packet")}
+)
+
+type pollingTransport struct{}
+
+func (pollingTransport) Name() string {
+	return TransportPolling
+}
+
+func (pollingTransport) Dial(ctx context.Context, s *Socket, u *url.URL) (Conn, error) {
+	u = transportURL(u, TransportPolling)
+	u.Scheme = httpScheme(u.Scheme)
+	jar, _ := cookiejar.New(nil)
+	c := &pollingConn{
+		client: &http.Client{Jar: jar},
+		url:    u,
+		header: s.header,
+	}
+	if s.opts.RoundTripper != nil {
+		c.client.Transport = s.opts.RoundTripper
+	} else if dial := s.netDialFunc(); dial != nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.DialContext = dial
+		c.client.Transport = tr
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	// the following requests are sent to where the handshake was redirected
+	c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := s.checkRedirect(via[len(via)-1].URL, req.URL, len(via)); err != nil {
+			return err
+		}
+		next := *req.URL
+		mergeQuery(&next, u)
+		c.header = redirectHeader(c.header, u, &next)
+		u, c.url = &next, &next
+		return nil
+	}
+	payload, err := c.do(ctx, http.MethodGet, nil)
+	if err != nil {
+		c.cancel()
+		return nil, err
+	}
+	c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return s.checkRedirect(via[len(via)-1].URL, req.URL, len(via))
+	}
+	frames := splitPayload(payload)
+	if len(frames) == 0 || len(frames[0]) == 0 || frames[0][0] != OPEN.ID() {
+		c.cancel()
+		return nil, errPollingHandshake
+	}
+	var obj struct {
+		Sid        string `json:"sid"`
+		MaxPayload int    `json:"maxPayload"`
+	}
+	if err := json.Unmarshal(frames[0][1:], &obj); err != nil {
+		c.cancel()
+		return nil, &HandshakeError{err}
+	}
+	query := u.Query()
+	query.Set("sid", obj.Sid)
+	u.RawQuery = query.Encode()
+	c.frames = frames
+	c.maxPayload = obj.MaxPayload
+	return c, nil
+}
+
+type pollingConn struct {
+	client *http.Client
+	url    *url.URL
+	header http.Header
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	frames [][]byte
+	// paused stops the reader from polling, see pause
+	paused  atomic.Bool
+	drained chan struct{}
+
+	maxPayload int
+	readLimit  atomic.Int64
+	writeMux   sync.Mutex
+	queue      [][]byte
+	writing    bool
+	flushed    chan struct{} // closed when the flusher exits
+	writeErr   error
+}
+
+var (
+	_ Conn         = (*pollingConn)(nil)
+	_ readLimiter  = (*pollingConn)(nil)
+	_ queueDepther = (*pollingConn)(nil)
+)
+
+func (c *pollingConn) queueDepth() int {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	return len(c.queue)
+}
+
+func (c *pollingConn) setReadLimit(limit int64) {
+	c.readLimit.Store(limit)
+}
+
+func (c *pollingConn) do(ctx context.Context, method string, body []byte) (res []byte, err error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url.String(), r)
+	if err != nil {
+		return
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError(resp, fmt.Errorf("polling %s request failed", method))
+	}
+	defer resp.Body.Close()
+	limit := c.readLimit.Load()
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	if res, err = io.ReadAll(io.LimitReader(resp.Body, limit+1)); err != nil {
+		return
+	}
+	if (int64)(len(res)) > limit {
+		return nil, &ReadLimitError{Limit: limit}
+	}
+	return
+}
+
+func (c *pollingConn) ReadFrame(buf []byte) (binary bool, data []byte, err error) {
+	for len(c.frames) == 0 {
+		if c.paused.Load() {
+			c.writeMux.Lock()
+			if c.drained != nil {
+				close(c.drained)
+				c.drained = nil
+			}
+			c.writeMux.Unlock()
+			return false, buf[:0], errPollingPaused
+		}
+		var payload []byte
+		if payload, err = c.do(c.ctx, http.MethodGet, nil); err != nil {
+			c.writeMux.Lock()
+			if c.writeErr != nil {
+				err = c.writeErr
+			}
+			c.writeMux.Unlock()
+			return false, buf[:0], err
+		}
+		c.frames = splitPayload(payload)
+	}
+	frame := c.frames[0]
+	c.frames[0] = nil
+	c.frames = c.frames[1:]
+	return false, append(buf[:0], frame...), nil
+}
+
+// WriteFrame queues the frame and returns immediately.
+// Frames queued while a POST request is in flight will be batched into the next request.
+// Binary frames are sent as base64 encoded BINARY packets
+func (c *pollingConn) WriteFrame(binary bool, data []byte) error {
+	var frame []byte
+	if binary {
+		frame = make([]byte, 1+base64.StdEncoding.EncodedLen(len(data)))
+		frame[0] = BINARY.ID()
+		base64.StdEncoding.Encode(frame[1:], data)
+	} else {
+		frame = append(make([]byte, 0, len(data)), data...)
+	}
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	c.queue = append(c.queue, frame)
+	if !c.writing {
+		c.writing = true
+		c.flushed = make(chan struct{})
+		go c.flusher()
+	}
+	return nil
+}
+
+func (c *pollingConn) flusher() {
+	for {
+		c.writeMux.Lock()
+		if len(c.queue) == 0 {
+			c.writing = false
+			close(c.flushed)
+			c.writeMux.Unlock()
+			return
+		}
+		payload, n := encodePayload(c.queue, c.maxPayload)
+		for i := 0; i < n; i++ {
+			c.queue[i] = nil
+		}
+		c.queue = c.queue[n:]
+		c.writeMux.Unlock()
+
+		if _, err := c.do(c.ctx, http.MethodPost, payload); err != nil {
+			c.writeMux.Lock()
+			c.writeErr = err
+			c.queue = nil
+			c.writing = false
+			close(c.flushed)
+			c.writeMux.Unlock()
+			// let the reader report the error
+			c.cancel()
+			return
+		}
+	}
+}
+
+// pause stops polling after the pending GET request returned, which the server ends with a NOOP packet during upgrade.
+// It waits until the queued frames were sent and the reader consumed the received ones
+func (c *pollingConn) pause(ctx context.Context) error {
+	c.writeMux.Lock()
+	drained := make(chan struct{})
+	c.drained = drained
+	c.paused.Store(true)
+	flushed, writing := c.flushed, c.writing
+	c.writeMux.Unlock()
+	if writing {
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *pollingConn) resume() {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	c.paused.Store(false)
+	c.drained = nil
+}
+
+// sessionURL returns the request URL of the session, which includes the sid
+func (c *pollingConn) sessionURL() *url.URL {
+	u := *c.url
+	return &u
+}
+
+// Close waits a while for the queued frames to be sent, e.g. the CLOSE packet, and then cancels all requests
+func (c *pollingConn) Close() error {
+	c.writeMux.Lock()
+	flushed := c.flushed
+	writing := c.writing
+	c.writeMux.Unlock()
+	if writing {
+		select {
+		case <-flushed:
+		case <-time.After(pollingCloseTimeout):
+		case <-c.ctx.Done():
+		}
+	}
+	c.cancel()
+	return nil
+}
+
+// encodePayload joins the leading frames which fit in maxPayload, at least one frame will be taken.
+// It returns the payload and how many frames were taken
+func encodePayload(frames [][]byte, maxPayload int) (payload []byte, n int) {
+	size := len(frames[0])
+	for n = 1; n < len(frames); n++ {
+		next := size + 1 + len(frames[n])
+		if maxPayload > 0 && next > maxPayload {
+			break
+		}
+		size = next
+	}
+	if n == 1 {
+		return frames[0], 1
+	}
+	return bytes.Join(frames[:n], []byte{payloadSeparator}), n
+}
+
+// ParsePayload splits a polling payload by the record separator and decodes every packet in it.
+// Like ParsePacket, it is safe to be used as a fuzz target
+func ParsePayload(payload []byte) (pkts []*Packet, err error) {
+	frames := splitPayload(payload)
+	pkts = make([]*Packet, len(frames))
+	for i, frame := range frames {
+		if pkts[i], err = ParsePacket(frame); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func splitPayload(payload []byte) [][]byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	return bytes.Split(payload, []byte{payloadSeparator})
+}
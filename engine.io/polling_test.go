@@ -0,0 +1,54 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package engine_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ahollic/socket.io/engine.io"
+)
+
+func FuzzParsePayload(f *testing.F) {
+	for _, seed := range []string{
+		"4hello\x1ebAAEC\x1e2probe",
+		`0{"sid":"abc","upgrades":[],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`,
+		"6",
+		"4a\x1e\x1e4b",
+		"\x1e",
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		orig := bytes.Clone(payload)
+		pkts, err := engine.ParsePayload(payload)
+		if !bytes.Equal(payload, orig) {
+			t.Fatalf("ParsePayload modified its input %q to %q", orig, payload)
+		}
+		if err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			if pkt == nil {
+				t.Fatalf("ParsePayload returned a nil packet for %q", payload)
+			}
+		}
+	})
+}
@@ -0,0 +1,240 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahollic/socket.io/internal/utils"
+)
+
+var ErrPoolClosed = errors.New("Engine.IO: pool is closed")
+
+// Pool maintains parallel engine sockets to the same server and distributes emits across them.
+// Packets emitted through a Pool may arrive out of order, since they can go through different connections.
+// A socket that failed to reconnect RetireAfter times in a row, or that was closed and will not reconnect
+// by itself, is closed and replaced by a new one
+type Pool struct {
+	// RetireAfter default is 3
+	RetireAfter int
+
+	opts Options
+	size int
+
+	mux     sync.RWMutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	sockets []*Socket
+	// replacing marks the slots of sockets whose replacement is in progress
+	replacing []bool
+	next      atomic.Uint64
+
+	messageHandles utils.HandlerList[*Socket, []byte]
+	binaryHandlers utils.HandlerList[*Socket, []byte]
+}
+
+// NewPool creates a pool of size sockets with the same options
+func NewPool(opts Options, size int) (p *Pool, err error) {
+	if size <= 0 {
+		size = 1
+	}
+	// validate options
+	if _, err = NewSocket(opts); err != nil {
+		return
+	}
+	p = &Pool{
+		opts: opts,
+		size: size,
+	}
+	return
+}
+
+// Dial connects all sockets, it fails if any socket could not connect
+func (p *Pool) Dial(ctx context.Context) (err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.sockets != nil {
+		return ErrSocketConnected
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	sockets := make([]*Socket, p.size)
+	for i := range sockets {
+		if sockets[i], err = p.newSocket(p.ctx); err != nil {
+			for _, s := range sockets[:i] {
+				s.Close()
+			}
+			p.cancel()
+			return
+		}
+	}
+	p.sockets = sockets
+	p.replacing = make([]bool, len(sockets))
+	return
+}
+
+func (p *Pool) newSocket(ctx context.Context) (s *Socket, err error) {
+	if s, err = NewSocket(p.opts); err != nil {
+		return
+	}
+	s.OnMessage(func(s *Socket, data []byte) {
+		p.messageHandles.Call(s, data)
+	})
+	s.OnBinary(func(s *Socket, data []byte) {
+		p.binaryHandlers.Call(s, data)
+	})
+	s.OnDialError(func(s *Socket, err *DialErrorContext) {
+		retireAfter := p.RetireAfter
+		if retireAfter <= 0 {
+			retireAfter = 3
+		}
+		if err.Count() >= retireAfter {
+			go p.replace(s)
+		}
+	})
+	s.OnStateChange(func(s *Socket, change StateChange) {
+		// the socket gave up reconnecting, or the connection was lost with reconnection disabled
+		if change.To == StateFailed || (change.To == StateClosed && change.Cause != nil) {
+			go p.replace(s)
+		}
+	})
+	if err = s.Dial(ctx); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// replace closes the socket and dials a new one until it succeeds or the pool is closed.
+// It does nothing if old is not in the pool or its slot is already being replaced
+func (p *Pool) replace(old *Socket) {
+	p.mux.Lock()
+	slot := -1
+	for i, s0 := range p.sockets {
+		if s0 == old {
+			slot = i
+			break
+		}
+	}
+	if slot < 0 || p.replacing[slot] {
+		p.mux.Unlock()
+		return
+	}
+	p.replacing[slot] = true
+	ctx := p.ctx
+	p.mux.Unlock()
+
+	old.Close()
+	delay := time.Second
+	for {
+		s, err := p.newSocket(ctx)
+		if err == nil {
+			p.mux.Lock()
+			if p.sockets != nil && p.sockets[slot] == old {
+				p.sockets[slot] = s
+				p.replacing[slot] = false
+				p.mux.Unlock()
+				return
+			}
+			p.mux.Unlock()
+			// pool was closed
+			s.Close()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// Sockets returns a snapshot of the sockets in the pool
+func (p *Pool) Sockets() []*Socket {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	return append(([]*Socket)(nil), p.sockets...)
+}
+
+// pick returns the next connected socket
+func (p *Pool) pick() (*Socket, error) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	if p.sockets == nil {
+		return nil, ErrPoolClosed
+	}
+	n := (uint64)(len(p.sockets))
+	start := p.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if s := p.sockets[(start+i)%n]; s.Connected() {
+			return s, nil
+		}
+	}
+	return nil, ErrNotConnected
+}
+
+// Emit sends the message through the next connected socket
+func (p *Pool) Emit(body []byte) error {
+	s, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return s.Emit(body)
+}
+
+// EmitBinary sends the data through the next connected socket
+func (p *Pool) EmitBinary(data []byte) error {
+	s, err := p.pick()
+	if err != nil {
+		return err
+	}
+	return s.EmitBinary(data)
+}
+
+// OnMessage registers the callback on every socket of the pool
+func (p *Pool) OnMessage(cb func(s *Socket, data []byte)) {
+	p.messageHandles.On(cb)
+}
+
+// OnBinary registers the callback on every socket of the pool
+func (p *Pool) OnBinary(cb func(s *Socket, data []byte)) {
+	p.binaryHandlers.On(cb)
+}
+
+// Close closes all sockets and stops replacing them
+func (p *Pool) Close() error {
+	p.mux.Lock()
+	sockets := p.sockets
+	p.sockets = nil
+	p.replacing = nil
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.mux.Unlock()
+	for _, s := range sockets {
+		s.Close()
+	}
+	return nil
+}
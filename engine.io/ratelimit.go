@@ -0,0 +1,192 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited = errors.New("Engine.IO: outgoing rate limit exceeded")
+	// ErrRateLimitDropped is returned for the packets discarded by RateLimitDrop, it wraps ErrRateLimited
+	ErrRateLimitDropped = fmt.Errorf("%w, packet dropped", ErrRateLimited)
+)
+
+type RateLimitPolicy int
+
+const (
+	// RateLimitWait blocks Emit until the packet is allowed.
+	// The wait ends with ErrNotConnected if the socket is closed, or the cause of the Dial context if it is done
+	RateLimitWait RateLimitPolicy = iota
+	// RateLimitDrop discards the packet and makes Emit return ErrRateLimitDropped,
+	// so the caller knows it was not sent
+	RateLimitDrop
+	// RateLimitReject makes Emit return ErrRateLimited
+	RateLimitReject
+)
+
+// RateLimit limits the messages sent by Emit and EmitBinary with token buckets,
+// zero rate means unlimited. Burst defaults to one second of the rate
+type RateLimit struct {
+	Packets     float64 // packets per second
+	PacketBurst int
+	Bytes       float64 // bytes per second
+	ByteBurst   int
+	Policy      RateLimitPolicy
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := (float64)(burst)
+	if b <= 0 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+	}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// need caps n at burst, so a request larger than burst can pass once the bucket is full
+func (b *tokenBucket) need(n float64) float64 {
+	if n > b.burst {
+		return b.burst
+	}
+	return n
+}
+
+type rateLimiter struct {
+	mux     sync.Mutex
+	policy  RateLimitPolicy
+	packets *tokenBucket
+	bytes   *tokenBucket
+}
+
+func newRateLimiter(cfg *RateLimit) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+	l := &rateLimiter{
+		policy:  cfg.Policy,
+		packets: newTokenBucket(cfg.Packets, cfg.PacketBurst),
+		bytes:   newTokenBucket(cfg.Bytes, cfg.ByteBurst),
+	}
+	if l.packets == nil && l.bytes == nil {
+		return nil
+	}
+	return l
+}
+
+// allow reports whether a packet of size bytes can be sent, waiting if the policy is RateLimitWait
+// until ctx is done or closed is closed
+func (l *rateLimiter) allow(ctx context.Context, closed <-chan struct{}, size int) (ok bool, err error) {
+	if l == nil {
+		return true, nil
+	}
+	l.mux.Lock()
+	now := time.Now()
+	var wait time.Duration
+	ok = true
+	for _, b := range [...]struct {
+		b *tokenBucket
+		n float64
+	}{{l.packets, 1}, {l.bytes, (float64)(size)}} {
+		if b.b == nil {
+			continue
+		}
+		b.b.advance(now)
+		if b.b.tokens < b.b.need(b.n) {
+			ok = false
+			if w := (time.Duration)((b.b.need(b.n) - b.b.tokens) / b.b.rate * (float64)(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	if ok || l.policy == RateLimitWait {
+		if l.packets != nil {
+			l.packets.tokens -= l.packets.need(1)
+		}
+		if l.bytes != nil {
+			l.bytes.tokens -= l.bytes.need((float64)(size))
+		}
+	}
+	l.mux.Unlock()
+
+	if ok {
+		return
+	}
+	switch l.policy {
+	case RateLimitWait:
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true, nil
+		case <-ctx.Done():
+			err = context.Cause(ctx)
+		case <-closed:
+			err = ErrNotConnected
+		}
+		l.refund(size)
+		return false, err
+	case RateLimitReject:
+		return false, ErrRateLimited
+	}
+	return false, ErrRateLimitDropped
+}
+
+// refund gives back the tokens taken for a packet which was not sent
+func (l *rateLimiter) refund(size int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.packets != nil {
+		l.packets.tokens += l.packets.need(1)
+	}
+	if l.bytes != nil {
+		l.bytes.tokens += l.bytes.need((float64)(size))
+	}
+}
@@ -0,0 +1,70 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"errors"
+)
+
+// DisconnectReason is a disconnect reason with the same values as the JS client
+type DisconnectReason string
+
+const (
+	// ReasonServerDisconnect means the server disconnected the socket from the namespace
+	ReasonServerDisconnect DisconnectReason = "io server disconnect"
+	// ReasonClientDisconnect means the socket was closed by the client
+	ReasonClientDisconnect DisconnectReason = "io client disconnect"
+	// ReasonPingTimeout means the server did not send a PING in time
+	ReasonPingTimeout DisconnectReason = "ping timeout"
+	// ReasonTransportClose means the connection was closed by the server
+	ReasonTransportClose DisconnectReason = "transport close"
+	// ReasonTransportError means the connection failed
+	ReasonTransportError DisconnectReason = "transport error"
+	// ReasonParseError means the server sent an invalid packet
+	ReasonParseError DisconnectReason = "parse error"
+)
+
+// ReasonOf returns the disconnect reason of the error passed to the OnDisconnect callbacks,
+// a nil error means the client closed the socket
+func ReasonOf(err error) DisconnectReason {
+	if err == nil {
+		return ReasonClientDisconnect
+	}
+	var (
+		sce *ServerCloseError
+		pe  *ProtocolError
+		upe *UnexpectedPacketTypeError
+		he  *HandshakeError
+	)
+	switch {
+	case errors.Is(err, ErrPingTimeout):
+		return ReasonPingTimeout
+	case errors.As(err, &sce):
+		return ReasonTransportClose
+	case errors.As(err, &pe), errors.As(err, &upe), errors.As(err, &he):
+		return ReasonParseError
+	}
+	return ReasonTransportError
+}
+
+// DisconnectReason returns the reason of CloseReason
+func (s *Socket) DisconnectReason() DisconnectReason {
+	return ReasonOf(s.CloseReason())
+}
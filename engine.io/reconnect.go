@@ -0,0 +1,163 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrReconnectVetoed = errors.New("Engine.IO: reconnect attempt was vetoed")
+
+// ReconnectAttempt is passed to the OnReconnectAttempt callbacks before each redial
+type ReconnectAttempt struct {
+	// Attempt is the number of the attempt since the connection was lost, starting from 1
+	Attempt int
+	// Delay is the backoff delay scheduled before this attempt
+	Delay time.Duration
+	// Header and Query are added to the request of this attempt only,
+	// they override ExtraHeaders, ExtraQuery and the providers
+	Header http.Header
+	Query  url.Values
+
+	vetoed bool
+}
+
+// Veto skips this attempt, the next one will be scheduled with backoff
+func (a *ReconnectAttempt) Veto() {
+	a.vetoed = true
+}
+
+// OnReconnectAttempt registers the callback which is called before each redial
+func (s *Socket) OnReconnectAttempt(cb func(s *Socket, attempt *ReconnectAttempt)) {
+	s.attemptHandles.On(cb)
+}
+
+// OnReconnectFailed registers the callback which is called when the socket gave up reconnecting
+func (s *Socket) OnReconnectFailed(cb func(s *Socket)) {
+	s.reconnectFailedHandles.On(func(s *Socket, _ struct{}) {
+		cb(s)
+	})
+}
+
+func (s *Socket) onReconnectAttempt() (attempt *ReconnectAttempt, err error) {
+	s.mux.RLock()
+	attempt = &ReconnectAttempt{
+		Attempt: s.reDialCount + 1,
+		Delay:   s.reDialDelay,
+	}
+	s.mux.RUnlock()
+	s.protect(func() {
+		s.attemptHandles.Call(s, attempt)
+	})
+	if attempt.vetoed {
+		s.mux.Lock()
+		s.reDialCount++
+		s.mux.Unlock()
+		return nil, ErrReconnectVetoed
+	}
+	return
+}
+
+// TriggerReconnect cancels the pending reconnect timer and dials immediately.
+// It does nothing if the socket is not waiting to reconnect
+func (s *Socket) TriggerReconnect() (err error) {
+	timer := s.reconnectTimer.Swap(nil)
+	if timer == nil {
+		return nil
+	}
+	timer.Stop()
+	if s.suspended.Load() {
+		return nil
+	}
+	s.mux.RLock()
+	dialCtx := s.dialCtx
+	s.mux.RUnlock()
+	s.protect(func() {
+		err = s.reDial()
+	})
+	if err != nil && err != ErrSocketConnected {
+		s.nextReconnect(dialCtx)
+	}
+	return
+}
+
+// ReconnectNow resets the backoff and dials immediately if the socket is waiting to reconnect
+func (s *Socket) ReconnectNow() error {
+	s.resetBackoff()
+	return s.TriggerReconnect()
+}
+
+// ResetBackoff resets the reconnect delay to the initial one,
+// a pending reconnect will be rescheduled with the reset delay
+func (s *Socket) ResetBackoff() {
+	dialCtx := s.resetBackoff()
+	if s.reconnectTimer.Load() != nil && dialCtx != nil {
+		s.nextReconnect(dialCtx)
+	}
+}
+
+func (s *Socket) resetBackoff() (dialCtx context.Context) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.reDialCount = 0
+	s.reDialTimeout = time.Second
+	return s.dialCtx
+}
+
+// WatchNetwork polls the addresses of the network interfaces every interval until ctx is done,
+// and calls TriggerReconnect when they changed
+func (s *Socket) WatchNetwork(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := interfaceAddrs()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if addrs := interfaceAddrs(); addrs != last {
+				last = addrs
+				s.TriggerReconnect()
+			}
+		}
+	}()
+}
+
+func interfaceAddrs() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	list := make([]string, len(addrs))
+	for i, a := range addrs {
+		list[i] = a.String()
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,125 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultMaxRedirects is the number of redirects followed when Options.MaxRedirects is zero
+const defaultMaxRedirects = 10
+
+var (
+	ErrTooManyRedirects    = errors.New("Engine.IO: stopped after too many redirects")
+	ErrCrossOriginRedirect = errors.New("Engine.IO: redirect to another origin is not allowed")
+)
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// checkRedirect reports whether the hops-th redirect from one URL to another may be followed
+func (s *Socket) checkRedirect(from, to *url.URL, hops int) error {
+	max := s.opts.MaxRedirects
+	if max == 0 {
+		max = defaultMaxRedirects
+	}
+	if hops > max {
+		return ErrTooManyRedirects
+	}
+	if !s.opts.CrossOriginRedirects && !sameOrigin(from, to) {
+		return ErrCrossOriginRedirect
+	}
+	return nil
+}
+
+// redirectLocation returns the URL which the websocket handshake is redirected to,
+// or nil if resp is not a redirect
+func (s *Socket) redirectLocation(cur *url.URL, resp *http.Response, hops int) (*url.URL, error) {
+	if !isRedirect(resp.StatusCode) {
+		return nil, nil
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, nil
+	}
+	base := *cur
+	base.Scheme = httpScheme(cur.Scheme)
+	next, err := base.Parse(loc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRedirect(&base, next, hops); err != nil {
+		return nil, err
+	}
+	next.Scheme = wsScheme(next.Scheme == "https" || next.Scheme == "wss")
+	mergeQuery(next, cur)
+	return next, nil
+}
+
+// mergeQuery adds the query parameters of from which are missing in u
+func mergeQuery(u, from *url.URL) {
+	query := u.Query()
+	for k, v := range from.Query() {
+		if _, ok := query[k]; !ok {
+			query[k] = v
+		}
+	}
+	u.RawQuery = query.Encode()
+}
+
+// sensitiveHeaders are not sent to another host after a redirect, like net/http does
+var sensitiveHeaders = []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2", "Proxy-Authorization"}
+
+// redirectHeader returns the headers which may be sent to the redirect target to,
+// the credentials are removed unless to is the host of from or its subdomain
+func redirectHeader(header http.Header, from, to *url.URL) http.Header {
+	src, dst := strings.ToLower(from.Hostname()), strings.ToLower(to.Hostname())
+	if dst == src || strings.HasSuffix(dst, "."+src) {
+		return header
+	}
+	stripped := header.Clone()
+	for _, k := range sensitiveHeaders {
+		stripped.Del(k)
+	}
+	return stripped
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return httpScheme(a.Scheme) == httpScheme(b.Scheme) && a.Host == b.Host
+}
+
+func httpScheme(scheme string) string {
+	switch scheme {
+	case "wss":
+		return "https"
+	case "ws":
+		return "http"
+	}
+	return scheme
+}
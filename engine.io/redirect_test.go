@@ -0,0 +1,82 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package engine_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/gorilla/websocket"
+)
+
+func TestCrossOriginRedirectStripsCredentials(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		headers <- req.Header.Clone()
+		conn, err := (&websocket.Upgrader{}).Upgrade(rw, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"redirected","upgrades":[],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer target.Close()
+	// the same server under another host name
+	location := strings.Replace(target.URL, "127.0.0.1", "localhost", 1) + "/engine.io/"
+	origin := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Redirect(rw, req, location, http.StatusFound)
+	}))
+	defer origin.Close()
+
+	s, err := engine.NewSocket(engine.Options{
+		Host: origin.Listener.Addr().String(),
+		Path: "/engine.io/",
+		ExtraHeaders: http.Header{
+			"Authorization": {"Bearer secret"},
+			"X-Client":      {"test"},
+		},
+		CrossOriginRedirects: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h := <-headers
+	if v := h.Get("Authorization"); v != "" {
+		t.Errorf("Authorization %q was sent to another host", v)
+	}
+	if v := h.Get("X-Client"); v != "test" {
+		t.Errorf("X-Client is %q, want %q", v, "test")
+	}
+}
@@ -0,0 +1,111 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// SlowConsumer configures the detection of a socket which cannot keep up with its traffic
+type SlowConsumer struct {
+	// MaxDispatchLag is the longest time between receiving a message and its handlers returning,
+	// zero disables the check
+	MaxDispatchLag time.Duration
+	// MaxQueueDepth is the number of outgoing packets which may wait to be written,
+	// i.e. buffered before connected or queued by the polling transport. Zero disables the check
+	MaxQueueDepth int
+	// Disconnect closes the connection with the *SlowConsumerError once a threshold is exceeded
+	Disconnect bool
+}
+
+// SlowConsumerError is passed to OnSlowConsumer when a threshold of Options.SlowConsumer was exceeded
+type SlowConsumerError struct {
+	DispatchLag time.Duration
+	QueueDepth  int
+}
+
+var _ error = (*SlowConsumerError)(nil)
+
+func (e *SlowConsumerError) Error() string {
+	if e.QueueDepth > 0 {
+		return fmt.Sprintf("Engine.IO: slow consumer, %d outgoing packets queued", e.QueueDepth)
+	}
+	return fmt.Sprintf("Engine.IO: slow consumer, message handled after %v", e.DispatchLag)
+}
+
+// queueDepther is implemented by connections which queue the outgoing frames
+type queueDepther interface {
+	queueDepth() int
+}
+
+// OnSlowConsumer registers the callback which is called when a threshold of Options.SlowConsumer was exceeded.
+// It is called once until the socket recovers below the threshold
+func (s *Socket) OnSlowConsumer(cb func(s *Socket, err *SlowConsumerError)) {
+	s.slowHandles.On(cb)
+}
+
+// dispatch runs fn by the dispatcher and checks the dispatch lag after it returned
+func (s *Socket) dispatch(d *dispatcher, fn func()) {
+	cfg := s.opts.SlowConsumer
+	if cfg == nil || cfg.MaxDispatchLag <= 0 {
+		d.dispatch(fn)
+		return
+	}
+	recv := time.Now()
+	d.dispatch(func() {
+		fn()
+		if lag := time.Since(recv); lag > cfg.MaxDispatchLag {
+			s.onSlowConsumer(&s.slowDispatch, &SlowConsumerError{DispatchLag: lag})
+		} else {
+			s.slowDispatch.Store(false)
+		}
+	})
+}
+
+// checkQueue checks the number of outgoing packets waiting to be written
+func (s *Socket) checkQueue(conn Conn, buffered int) {
+	cfg := s.opts.SlowConsumer
+	if cfg == nil || cfg.MaxQueueDepth <= 0 {
+		return
+	}
+	depth := buffered
+	if q, ok := conn.(queueDepther); ok {
+		depth += q.queueDepth()
+	}
+	if depth > cfg.MaxQueueDepth {
+		s.onSlowConsumer(&s.slowQueue, &SlowConsumerError{QueueDepth: depth})
+	} else {
+		s.slowQueue.Store(false)
+	}
+}
+
+func (s *Socket) onSlowConsumer(flag *atomic.Bool, err *SlowConsumerError) {
+	if flag.Swap(true) {
+		return
+	}
+	s.protect(func() {
+		s.slowHandles.Call(s, err)
+	})
+	if s.opts.SlowConsumer.Disconnect {
+		s.onClose(err)
+	}
+}
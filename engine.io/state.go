@@ -0,0 +1,119 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"fmt"
+)
+
+// State is the detailed state of a socket, Status is the coarse view of it
+type State int32
+
+const (
+	// StateClosed means the socket is not connected and will not reconnect by itself
+	StateClosed State = iota
+	// StateDialing means the transport connection is being established
+	StateDialing
+	// StateHandshaking means the transport is connected and the OPEN packet is awaited
+	StateHandshaking
+	StateConnected
+	// StateUpgrading means the connection is being upgraded to another transport
+	StateUpgrading
+	// StateReconnecting means the connection was lost and the next reconnect attempt is scheduled
+	StateReconnecting
+	// StateFailed means the socket gave up reconnecting
+	StateFailed
+)
+
+func (st State) String() string {
+	switch st {
+	case StateClosed:
+		return "Closed"
+	case StateDialing:
+		return "Dialing"
+	case StateHandshaking:
+		return "Handshaking"
+	case StateConnected:
+		return "Connected"
+	case StateUpgrading:
+		return "Upgrading"
+	case StateReconnecting:
+		return "Reconnecting"
+	case StateFailed:
+		return "Failed"
+	}
+	return fmt.Sprintf("State(%d)", (int32)(st))
+}
+
+func (st State) MarshalText() ([]byte, error) {
+	return ([]byte)(st.String()), nil
+}
+
+// StateChange describes a state transition
+type StateChange struct {
+	From State
+	To   State
+	// Cause is the error which caused the transition, nil if it is expected
+	Cause error
+}
+
+// State returns the current state of the socket
+func (s *Socket) State() State {
+	return (State)(s.state.Load())
+}
+
+// OnStateChange registers the callback which is called after each state transition.
+// The callbacks are called in order on a separate goroutine, so the socket may already be in another state
+func (s *Socket) OnStateChange(cb func(s *Socket, change StateChange)) {
+	s.stateHandles.On(cb)
+}
+
+// setState moves the socket to the state and queues the notification
+func (s *Socket) setState(to State, cause error) {
+	s.stateMux.Lock()
+	defer s.stateMux.Unlock()
+	from := (State)(s.state.Swap((int32)(to)))
+	if from == to {
+		return
+	}
+	s.stateQueue = append(s.stateQueue, StateChange{From: from, To: to, Cause: cause})
+	if !s.stateNotifying {
+		s.stateNotifying = true
+		go s.notifyStates()
+	}
+}
+
+func (s *Socket) notifyStates() {
+	for {
+		s.stateMux.Lock()
+		if len(s.stateQueue) == 0 {
+			s.stateNotifying = false
+			s.stateMux.Unlock()
+			return
+		}
+		change := s.stateQueue[0]
+		s.stateQueue = s.stateQueue[1:]
+		s.stateMux.Unlock()
+
+		s.protect(func() {
+			s.stateHandles.Call(s, change)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// PacketStats counts the packets of a type and their encoded size
+type PacketStats struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// Stats is a snapshot of the counters of a socket
+type Stats struct {
+	// Sent and Received are indexed by the packet type, binary frames are counted as BINARY
+	Sent     map[PacketType]PacketStats
+	Received map[PacketType]PacketStats
+	// Reconnects is the number of successful reconnects
+	Reconnects uint64
+	// LastPingRTT is the round trip time measured by the last successful Ping
+	LastPingRTT time.Duration
+	// Buffered is the number of packets waiting for the connection
+	Buffered int
+	// ConnectedAt is when the current connection completed the handshake, zero if not connected
+	ConnectedAt time.Time
+	// Uptime is the duration since ConnectedAt
+	Uptime time.Duration
+}
+
+var statsTypes = [...]PacketType{OPEN, CLOSE, PING, PONG, MESSAGE, UPGRADE, NOOP, BINARY}
+
+type packetCounter struct {
+	packets atomic.Uint64
+	bytes   atomic.Uint64
+}
+
+type packetCounters [len(statsTypes)]packetCounter
+
+func (c *packetCounters) add(typ PacketType, size int) {
+	i := (int)(typ - OPEN)
+	if typ == BINARY {
+		i = len(statsTypes) - 1
+	}
+	if i < 0 || i >= len(c) {
+		return
+	}
+	c[i].packets.Add(1)
+	c[i].bytes.Add((uint64)(size))
+}
+
+func (c *packetCounters) snapshot() map[PacketType]PacketStats {
+	m := make(map[PacketType]PacketStats, len(statsTypes))
+	for i, typ := range statsTypes {
+		if n := c[i].packets.Load(); n > 0 {
+			m[typ] = PacketStats{
+				Packets: n,
+				Bytes:   c[i].bytes.Load(),
+			}
+		}
+	}
+	return m
+}
+
+// Stats returns a snapshot of the counters of the socket
+func (s *Socket) Stats() Stats {
+	st := Stats{
+		Sent:        s.sentStats.snapshot(),
+		Received:    s.recvStats.snapshot(),
+		Reconnects:  s.reconnects.Load(),
+		LastPingRTT: (time.Duration)(s.lastRTT.Load()),
+	}
+	s.mux.RLock()
+	st.Buffered = len(s.msgbuf)
+	s.mux.RUnlock()
+	if at := s.connectedAt.Load(); at != 0 && s.Connected() {
+		st.ConnectedAt = time.Unix(0, at)
+		st.Uptime = time.Since(st.ConnectedAt)
+	}
+	return st
+}
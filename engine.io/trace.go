@@ -0,0 +1,55 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"encoding/hex"
+	"log"
+	"strings"
+)
+
+// TraceDumpSize is the number of bytes of each frame included in the trace hexdump
+const TraceDumpSize = 64
+
+// SetTrace starts logging every frame sent and received to the logger,
+// with its direction, packet type, size and a truncated hexdump.
+// A nil logger stops the tracing
+func (s *Socket) SetTrace(logger *log.Logger) {
+	s.tracer.Store(logger)
+}
+
+func (s *Socket) trace(dir string, binary bool, data []byte) {
+	logger := s.tracer.Load()
+	if logger == nil {
+		return
+	}
+	typ := BINARY
+	if !binary {
+		typ = unknownType
+		if len(data) > 0 {
+			typ = pktTypeFromByte(data[0])
+		}
+	}
+	dump, more := data, ""
+	if len(dump) > TraceDumpSize {
+		dump, more = dump[:TraceDumpSize], "\n..."
+	}
+	logger.Printf("Engine.IO: trace %s %s %d bytes\n%s%s", dir, typ, len(data), strings.TrimSuffix(hex.Dump(dump), "\n"), more)
+}
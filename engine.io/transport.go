@@ -0,0 +1,95 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	TransportWebsocket = "websocket"
+	TransportPolling   = "polling"
+)
+
+type UnsupportedTransportError struct {
+	Name string
+}
+
+var _ error = (*UnsupportedTransportError)(nil)
+
+func (e *UnsupportedTransportError) Error() string {
+	return fmt.Sprintf("Engine.IO: unsupported transport %q", e.Name)
+}
+
+// Transport dials a Conn for a Socket
+type Transport interface {
+	// Name returns the value of the `transport` query parameter
+	Name() string
+	// Dial connects to the Engine.IO endpoint u.
+	// The ctx only bounds the dialing, it must not be retained by the returned Conn
+	Dial(ctx context.Context, s *Socket, u *url.URL) (Conn, error)
+}
+
+// Conn is an established transport connection, frames are encoded Engine.IO packets
+// except binary frames, which are raw binary payloads
+type Conn interface {
+	// ReadFrame reads the next frame by appending it to buf[:0],
+	// it will be called by only one goroutine
+	ReadFrame(buf []byte) (binary bool, data []byte, err error)
+	WriteFrame(binary bool, data []byte) error
+	Close() error
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+func (o *Options) getTransport(name string) (Transport, error) {
+	if t, ok := o.CustomTransports[name]; ok {
+		return t, nil
+	}
+	switch name {
+	case TransportWebsocket:
+		return websocketTransport{}, nil
+	case TransportPolling:
+		return pollingTransport{}, nil
+	}
+	return nil, &UnsupportedTransportError{name}
+}
+
+// readLimiter is implemented by the builtin connections to limit the size of received messages
+type readLimiter interface {
+	setReadLimit(limit int64)
+}
+
+func transportURL(u *url.URL, name string) *url.URL {
+	u2 := *u
+	query := u2.Query()
+	query.Set("transport", name)
+	u2.RawQuery = query.Encode()
+	return &u2
+}
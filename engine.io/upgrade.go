@@ -0,0 +1,289 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// upgradeTimeout bounds the probe and the pause of the polling transport during an upgrade
+const upgradeTimeout = 10 * time.Second
+
+var (
+	errPollingPaused = errors.New("Engine.IO: polling transport is paused")
+	errProbeFailed   = errors.New("Engine.IO: websocket probe was not answered")
+)
+
+type pendingFrame struct {
+	binary bool
+	data   []byte
+}
+
+// upgradeConn is a polling connection which can be upgraded to websocket,
+// the socket keeps using it while the transports are switched underneath
+type upgradeConn struct {
+	poll *pollingConn
+
+	mux       sync.Mutex
+	cur       Conn
+	closed    bool
+	paused    bool
+	pending   []pendingFrame
+	done      chan struct{} // closed when the pause ended
+	readLimit int64         // applied to the websocket connection when switched to it
+}
+
+var (
+	_ Conn           = (*upgradeConn)(nil)
+	_ readLimiter    = (*upgradeConn)(nil)
+	_ queueDepther   = (*upgradeConn)(nil)
+	_ readDeadliner  = (*upgradeConn)(nil)
+	_ writeDeadliner = (*upgradeConn)(nil)
+)
+
+func newUpgradeConn(poll *pollingConn) *upgradeConn {
+	return &upgradeConn{
+		poll: poll,
+		cur:  poll,
+	}
+}
+
+func (c *upgradeConn) current() Conn {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.cur
+}
+
+func (c *upgradeConn) upgraded() bool {
+	return c.current() != c.poll
+}
+
+func (c *upgradeConn) setReadLimit(limit int64) {
+	c.mux.Lock()
+	c.readLimit = limit
+	cur := c.cur
+	c.mux.Unlock()
+	if rl, ok := cur.(readLimiter); ok {
+		rl.setReadLimit(limit)
+	}
+}
+
+func (c *upgradeConn) queueDepth() int {
+	if q, ok := c.current().(queueDepther); ok {
+		return q.queueDepth()
+	}
+	return 0
+}
+
+func (c *upgradeConn) SetReadDeadline(t time.Time) error {
+	if rd, ok := c.current().(readDeadliner); ok {
+		return rd.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *upgradeConn) SetWriteDeadline(t time.Time) error {
+	if wd, ok := c.current().(writeDeadliner); ok {
+		return wd.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// ReadFrame reads from the current transport, while the polling transport is paused
+// it waits until the upgrade finished or was given up
+func (c *upgradeConn) ReadFrame(buf []byte) (binary bool, data []byte, err error) {
+	for {
+		binary, data, err = c.current().ReadFrame(buf)
+		if err != errPollingPaused {
+			return
+		}
+		c.mux.Lock()
+		done, paused := c.done, c.paused
+		c.mux.Unlock()
+		if paused {
+			<-done
+		}
+	}
+}
+
+// WriteFrame writes to the current transport, the frames written while the polling transport is paused
+// are sent after the pause ended
+func (c *upgradeConn) WriteFrame(binary bool, data []byte) error {
+	c.mux.Lock()
+	if c.paused {
+		defer c.mux.Unlock()
+		c.pending = append(c.pending, pendingFrame{binary, append(([]byte)(nil), data...)})
+		return nil
+	}
+	if c.cur == c.poll {
+		// queueing a polling frame does not block
+		defer c.mux.Unlock()
+		return c.poll.WriteFrame(binary, data)
+	}
+	cur := c.cur
+	c.mux.Unlock()
+	return cur.WriteFrame(binary, data)
+}
+
+func (c *upgradeConn) Close() error {
+	c.mux.Lock()
+	cur := c.cur
+	c.closed = true
+	c.endPauseLocked()
+	c.mux.Unlock()
+	if cur != c.poll {
+		c.poll.cancel()
+	}
+	return cur.Close()
+}
+
+func (c *upgradeConn) pause() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.paused = true
+	c.done = make(chan struct{})
+}
+
+func (c *upgradeConn) endPauseLocked() {
+	if c.paused {
+		c.paused = false
+		close(c.done)
+	}
+}
+
+// flushLocked writes the frames queued during the pause to conn, c.mux must be held
+func (c *upgradeConn) flushLocked(conn Conn) (err error) {
+	for i, f := range c.pending {
+		c.pending[i] = pendingFrame{}
+		if err == nil {
+			err = conn.WriteFrame(f.binary, f.data)
+		}
+	}
+	c.pending = c.pending[:0]
+	return
+}
+
+// resume gives up the upgrade and continues polling
+func (c *upgradeConn) resume() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.poll.resume()
+	err := c.flushLocked(c.poll)
+	c.endPauseLocked()
+	return err
+}
+
+// switchTo sends the UPGRADE packet and the frames queued during the pause through ws,
+// which then replaces the polling transport with the read limit of it
+func (c *upgradeConn) switchTo(ws Conn) (err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return ErrNotConnected
+	}
+	if rl, ok := ws.(readLimiter); ok && c.readLimit > 0 {
+		rl.setReadLimit(c.readLimit)
+	}
+	if err = ws.WriteFrame(false, []byte{UPGRADE.ID()}); err != nil {
+		return
+	}
+	if err = c.flushLocked(ws); err != nil {
+		return
+	}
+	c.cur = ws
+	c.endPauseLocked()
+	return
+}
+
+// upgrade probes the websocket transport of the session, pauses the polling transport
+// once the server ended the pending request with a NOOP packet, and then switches to websocket.
+// The state goes back to StateConnected with the cause if the upgrade was given up
+func (s *Socket) upgrade(ctx context.Context, c *upgradeConn) {
+	s.setState(StateUpgrading, nil)
+	err := s._upgrade(ctx, c)
+	if err == nil {
+		s.mux.Lock()
+		s.transport = TransportWebsocket
+		s.mux.Unlock()
+	}
+	if s.State() == StateUpgrading {
+		s.setState(StateConnected, err)
+	}
+}
+
+func (s *Socket) _upgrade(ctx context.Context, c *upgradeConn) (err error) {
+	t, err := s.opts.getTransport(TransportWebsocket)
+	if err != nil {
+		return
+	}
+	connCtx := ctx
+	ctx, cancel := context.WithTimeout(ctx, upgradeTimeout)
+	defer cancel()
+
+	u := c.poll.sessionURL()
+	u.Scheme = wsScheme(u.Scheme == "https")
+	ws, err := t.Dial(ctx, s, u)
+	if err != nil {
+		return
+	}
+	// unblocks the probe if the server does not answer
+	stop := context.AfterFunc(ctx, func() {
+		ws.Close()
+	})
+	defer func() {
+		if !stop() && err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			ws.Close()
+		}
+	}()
+
+	if err = ws.WriteFrame(false, append([]byte{PING.ID()}, "probe"...)); err != nil {
+		return
+	}
+	_, data, err := ws.ReadFrame(nil)
+	if err != nil {
+		return
+	}
+	if string(data) != string(PONG.ID())+"probe" {
+		return errProbeFailed
+	}
+
+	// before the reader can use ws, the pong handler must not be set concurrently with a read
+	s.setupConn(connCtx, c, ws)
+	c.pause()
+	if err = c.poll.pause(ctx); err != nil {
+		c.resume()
+		return
+	}
+	if err = c.switchTo(ws); err != nil {
+		c.resume()
+		return
+	}
+	c.poll.Close()
+	if s.opts.ReadDeadline {
+		s.extendReadDeadline(c)
+	}
+	return
+}
@@ -0,0 +1,120 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newUpgradeServer serves a polling session which can be upgraded to websocket,
+// after the upgrade it sends a MESSAGE packet with the body msg
+func newUpgradeServer(t *testing.T, msg string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if query.Get("transport") == TransportWebsocket {
+			ws, err := upgrader.Upgrade(rw, req, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			if _, data, err := ws.ReadMessage(); err != nil || string(data) != "2probe" {
+				return
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte("3probe"))
+			if _, data, err := ws.ReadMessage(); err != nil || string(data) != "5" {
+				return
+			}
+			ws.WriteMessage(websocket.TextMessage, []byte("4"+msg))
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		switch {
+		case query.Get("sid") == "":
+			rw.Write([]byte(`0{"sid":"upgrade","upgrades":["websocket"],"pingInterval":25000,"pingTimeout":20000,"maxPayload":1000000}`))
+		case req.Method == http.MethodPost:
+			rw.Write([]byte("ok"))
+		default:
+			// ends the pending request like the JS server does during an upgrade
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-req.Context().Done():
+				return
+			}
+			rw.Write([]byte("6"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUpgradeKeepsReadLimit(t *testing.T) {
+	srv := newUpgradeServer(t, strings.Repeat("x", 2000))
+	s, err := NewSocket(Options{
+		Host:                srv.URL,
+		Path:                "/engine.io/",
+		Transports:          []string{TransportPolling},
+		Upgrade:             true,
+		ReadLimit:           1000,
+		DisableReconnection: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	disconnected := make(chan error, 1)
+	s.OnDisconnect(func(_ *Socket, err error) {
+		disconnected <- err
+	})
+	s.OnMessage(func(_ *Socket, data []byte) {
+		t.Errorf("received a message of %d bytes over the read limit", len(data))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-disconnected:
+		var rle *ReadLimitError
+		if !errors.As(err, &rle) {
+			t.Fatalf("disconnected with %v, want *ReadLimitError", err)
+		}
+		if rle.Limit != 1000 {
+			t.Errorf("ReadLimitError.Limit is %d, want 1000", rle.Limit)
+		}
+	case <-ctx.Done():
+		t.Fatal("the message over the read limit was not rejected")
+	}
+	if tr := s.Transport(); tr != TransportWebsocket {
+		t.Errorf("transport is %q after the upgrade, want %q", tr, TransportWebsocket)
+	}
+}
@@ -0,0 +1,83 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrReconnectFailed = errors.New("Engine.IO: socket gave up reconnecting")
+
+// WaitConnected blocks until the handshake completed, the socket failed, or the context is done
+func (s *Socket) WaitConnected(ctx context.Context) error {
+	return s.waitState(ctx, func(st State) (bool, error) {
+		switch st {
+		case StateConnected:
+			return true, nil
+		case StateFailed:
+			return true, ErrReconnectFailed
+		}
+		return false, nil
+	})
+}
+
+// WaitClosed blocks until the socket is closed and will not reconnect, or the context is done
+func (s *Socket) WaitClosed(ctx context.Context) error {
+	return s.waitState(ctx, func(st State) (bool, error) {
+		return st == StateClosed || st == StateFailed, nil
+	})
+}
+
+// DialAndWait dials and blocks until the handshake completed, so ID and Handshake are available.
+// Unlike Dial, ctx only bounds the dial and the handshake, the connection lives on after it is done.
+// The socket is closed and stops reconnecting if the handshake did not complete in time
+func (s *Socket) DialAndWait(ctx context.Context) (err error) {
+	if err = s.Dial(context.WithoutCancel(ctx)); err != nil {
+		return
+	}
+	if err = s.WaitConnected(ctx); err != nil {
+		// the failed handshake may have scheduled a reconnect already
+		s.Close()
+	}
+	return
+}
+
+func (s *Socket) waitState(ctx context.Context, match func(State) (bool, error)) error {
+	done := make(chan error, 1)
+	cancel := s.stateHandles.On(func(_ *Socket, change StateChange) {
+		if ok, err := match(change.To); ok {
+			select {
+			case done <- err:
+			default:
+			}
+		}
+	})
+	defer cancel()
+	if ok, err := match(s.State()); ok {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,120 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/ahollic/socket.io/internal/utils"
+	"github.com/gorilla/websocket"
+)
+
+type websocketTransport struct{}
+
+func (websocketTransport) Name() string {
+	return TransportWebsocket
+}
+
+func (websocketTransport) Dial(ctx context.Context, s *Socket, u *url.URL) (Conn, error) {
+	dialer := s.Dialer
+	if dial := s.netDialFunc(); dial != nil || s.opts.FlushInterval > 0 {
+		d := *dialer
+		if dial != nil {
+			d.NetDialContext = dial
+		}
+		if s.opts.FlushInterval > 0 {
+			d.NetDialContext = coalesceDialFunc(d.NetDialContext, s.opts.FlushInterval)
+		}
+		dialer = &d
+	}
+	target := transportURL(u, TransportWebsocket)
+	for hops := 1; ; hops++ {
+		wsconn, resp, err := dialer.DialContext(ctx, target.String(), redirectHeader(s.header, u, target))
+		if err == nil {
+			return &wsConn{Conn: wsconn}, nil
+		}
+		if resp == nil {
+			return nil, err
+		}
+		next, rerr := s.redirectLocation(target, resp, hops)
+		if next == nil {
+			if rerr != nil {
+				err = rerr
+			}
+			return nil, newResponseError(resp, err)
+		}
+		resp.Body.Close()
+		target = next
+	}
+}
+
+type wsConn struct {
+	*websocket.Conn
+	readLimit int64
+}
+
+var (
+	_ Conn        = (*wsConn)(nil)
+	_ readLimiter = (*wsConn)(nil)
+)
+
+func (c *wsConn) setReadLimit(limit int64) {
+	c.readLimit = limit
+	c.SetReadLimit(limit)
+}
+
+func (c *wsConn) ReadFrame(buf []byte) (binary bool, data []byte, err error) {
+	for {
+		code, r, err := c.NextReader()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				err = &ReadLimitError{Limit: c.readLimit}
+			} else if ce, ok := err.(*websocket.CloseError); ok {
+				err = &ServerCloseError{
+					Code:   ce.Code,
+					Reason: ce.Text,
+					Err:    ce,
+				}
+			}
+			return false, buf[:0], err
+		}
+		switch code {
+		case websocket.BinaryMessage:
+			binary = true
+		case websocket.TextMessage:
+		default:
+			continue
+		}
+		// the limit is usually exceeded while reading the message body
+		if data, err = utils.ReadAllTo(r, buf[:0]); errors.Is(err, websocket.ErrReadLimit) {
+			err = &ReadLimitError{Limit: c.readLimit}
+		}
+		return binary, data, err
+	}
+}
+
+func (c *wsConn) WriteFrame(binary bool, data []byte) error {
+	if binary {
+		return c.WriteMessage(websocket.BinaryMessage, data)
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,139 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+
+	socket "github.com/ahollic/socket.io"
+)
+
+// AlgAESGCM is the _enc field of payloads sealed by AESGCM
+const AlgAESGCM = "aes-gcm"
+
+var ErrNotSealed = errors.New("envelope: payload is not encrypted")
+
+// sealedPayload replaces the arguments of an encrypted event
+type sealedPayload struct {
+	Enc   string `json:"_enc"`
+	Kid   string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// AESGCM encrypts the event arguments with AES-GCM, the event name is authenticated as well.
+// The arguments are encrypted as JSON, so socket.Buffer attachments are not supported, use []byte instead.
+// The keys must be 16, 24 or 32 bytes long
+type AESGCM struct {
+	keys KeyProvider
+	// AllowPlaintext delivers events which are not encrypted instead of rejecting them
+	AllowPlaintext bool
+}
+
+var _ socket.PayloadCodec = (*AESGCM)(nil)
+
+func NewAESGCM(keys KeyProvider) *AESGCM {
+	return &AESGCM{
+		keys: keys,
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *AESGCM) Encode(event string, args []any) ([]any, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return []any{sealedPayload{
+		Enc:   AlgAESGCM,
+		Kid:   id,
+		Nonce: nonce,
+		Data:  aead.Seal(nil, nonce, plain, ([]byte)(event)),
+	}}, nil
+}
+
+func (c *AESGCM) Decode(event string, args []any) ([]any, error) {
+	var p sealedPayload
+	if !unwrapArg(args, &p) || p.Enc != AlgAESGCM {
+		if c.AllowPlaintext {
+			return args, nil
+		}
+		return nil, ErrNotSealed
+	}
+	key, err := c.keys.Key(p.Kid)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Nonce) != aead.NonceSize() {
+		return nil, ErrNotSealed
+	}
+	plain, err := aead.Open(nil, p.Nonce, p.Data, ([]byte)(event))
+	if err != nil {
+		return nil, err
+	}
+	var res []any
+	if err = json.Unmarshal(plain, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// unwrapArg decodes the only argument of args into ptr,
+// it reports false if there is not exactly one object argument
+func unwrapArg(args []any, ptr any) bool {
+	if len(args) != 1 {
+		return false
+	}
+	if _, ok := args[0].(map[string]any); !ok {
+		return false
+	}
+	data, err := json.Marshal(args[0])
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, ptr) == nil
+}
@@ -0,0 +1,136 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package envelope
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+
+	socket "github.com/ahollic/socket.io"
+)
+
+// AlgHMACSHA256 is the _sig field of payloads signed by HMAC
+const AlgHMACSHA256 = "hmac-sha256"
+
+var (
+	ErrNotSigned    = errors.New("envelope: payload is not signed")
+	ErrBadSignature = errors.New("envelope: signature mismatch")
+)
+
+// VerifyPolicy decides what to do with received events which failed the verification
+type VerifyPolicy int
+
+const (
+	// VerifyReject drops the event, the error is reported by socket.OnError
+	VerifyReject VerifyPolicy = iota
+	// VerifyFlag delivers the event as it is after calling OnInvalid
+	VerifyFlag
+)
+
+// signedPayload replaces the arguments of a signed event,
+// Data is the JSON encoded arguments which the signature was computed over
+type signedPayload struct {
+	Sig  string `json:"_sig"`
+	Kid  string `json:"kid"`
+	Mac  []byte `json:"mac"`
+	Data string `json:"data"`
+}
+
+// HMAC signs the event arguments with HMAC-SHA256 and the id of the key,
+// so the receiver can attribute the event to the owner of the key.
+// The arguments are signed as JSON, so socket.Buffer attachments are not supported
+type HMAC struct {
+	keys KeyProvider
+	// Policy applies to the events which are unsigned or have an invalid signature
+	Policy VerifyPolicy
+	// OnInvalid is called for every event which failed the verification
+	OnInvalid func(event string, args []any, err error)
+}
+
+var _ socket.PayloadCodec = (*HMAC)(nil)
+
+func NewHMAC(keys KeyProvider) *HMAC {
+	return &HMAC{
+		keys: keys,
+	}
+}
+
+func computeMAC(key []byte, event string, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(([]byte)(event))
+	m.Write([]byte{0})
+	m.Write(([]byte)(data))
+	return m.Sum(nil)
+}
+
+func (c *HMAC) Encode(event string, args []any) ([]any, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	return []any{signedPayload{
+		Sig:  AlgHMACSHA256,
+		Kid:  id,
+		Mac:  computeMAC(key, event, (string)(data)),
+		Data: (string)(data),
+	}}, nil
+}
+
+func (c *HMAC) Decode(event string, args []any) ([]any, error) {
+	res, err := c.verify(event, args)
+	if err == nil {
+		return res, nil
+	}
+	if c.OnInvalid != nil {
+		c.OnInvalid(event, args, err)
+	}
+	if c.Policy == VerifyFlag {
+		if res == nil {
+			res = args
+		}
+		return res, nil
+	}
+	return nil, err
+}
+
+// verify returns the signed arguments, they are returned even if the signature is invalid
+func (c *HMAC) verify(event string, args []any) (res []any, err error) {
+	var p signedPayload
+	if !unwrapArg(args, &p) || p.Sig != AlgHMACSHA256 {
+		return nil, ErrNotSigned
+	}
+	if err = json.Unmarshal(([]byte)(p.Data), &res); err != nil {
+		return nil, err
+	}
+	key, err := c.keys.Key(p.Kid)
+	if err != nil {
+		return
+	}
+	if !hmac.Equal(p.Mac, computeMAC(key, event, p.Data)) {
+		return res, ErrBadSignature
+	}
+	return res, nil
+}
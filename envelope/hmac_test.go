@@ -0,0 +1,89 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package envelope_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	socket "github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/ahollic/socket.io/envelope"
+	"github.com/ahollic/socket.io/socketiotest"
+)
+
+func TestHMACRejectBeforeDispatch(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	io, err := engine.NewSocket(srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer io.Close()
+	codec := envelope.NewHMAC(envelope.NewKeyRing("k1", []byte("secret")))
+	s := socket.NewSocket(io, socket.WithPayloadCodec(codec))
+
+	dispatched := make(chan string, 4)
+	s.OnPacket(func(_ *socket.Socket, pkt *socket.Packet) {
+		dispatched <- "packet"
+	})
+	s.OnMessage(func(event string, args []any) {
+		dispatched <- "message " + event
+	})
+	socket.Register(s, "rpc", func(ctx context.Context, req string) (string, error) {
+		dispatched <- "rpc"
+		return req, nil
+	})
+	rejected := make(chan error, 4)
+	s.OnError(func(_ *socket.Socket, err error) {
+		rejected <- err
+	})
+
+	if err := io.DialAndWait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ConnectAndWait(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// unsigned events must not reach any handler
+	c.Emit("/", "plain", "x")
+	c.Emit("/", "rpc", "x")
+	for i := 0; i < 2; i++ {
+		select {
+		case <-rejected:
+		case <-ctx.Done():
+			t.Fatal("unsigned event was not rejected")
+		}
+	}
+	select {
+	case h := <-dispatched:
+		t.Fatalf("unsigned event reached %s", h)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,110 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrNoCurrentKey = errors.New("envelope: no current key")
+
+// UnknownKeyError is returned when a payload refers to a key which the provider does not have
+type UnknownKeyError struct {
+	ID string
+}
+
+var _ error = (*UnknownKeyError)(nil)
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("envelope: unknown key %q", e.ID)
+}
+
+// KeyProvider supplies the keys of the codecs
+type KeyProvider interface {
+	// CurrentKey returns the key used to seal or sign new payloads
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of the id to open or verify received payloads
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is an in-memory KeyProvider.
+// To rotate keys, Rotate to the new key and Remove the old one once the peers have switched
+type KeyRing struct {
+	mux     sync.RWMutex
+	keys    map[string][]byte
+	current string
+}
+
+var _ KeyProvider = (*KeyRing)(nil)
+
+// NewKeyRing creates a KeyRing with the current key
+func NewKeyRing(id string, key []byte) *KeyRing {
+	r := &KeyRing{
+		keys: make(map[string][]byte),
+	}
+	r.Rotate(id, key)
+	return r
+}
+
+// Add adds a key which can only be used to open received payloads
+func (r *KeyRing) Add(id string, key []byte) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.keys[id] = key
+}
+
+// Rotate adds the key and makes it the current key
+func (r *KeyRing) Rotate(id string, key []byte) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.keys[id] = key
+	r.current = id
+}
+
+// Remove removes the key, the current key cannot be removed
+func (r *KeyRing) Remove(id string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if id != r.current {
+		delete(r.keys, id)
+	}
+}
+
+func (r *KeyRing) CurrentKey() (id string, key []byte, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	key, ok := r.keys[r.current]
+	if !ok {
+		return "", nil, ErrNoCurrentKey
+	}
+	return r.current, key, nil
+}
+
+func (r *KeyRing) Key(id string) ([]byte, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, &UnknownKeyError{id}
+	}
+	return key, nil
+}
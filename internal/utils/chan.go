@@ -0,0 +1,76 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"sync"
+)
+
+// Chan forwards values from callbacks to a buffered channel until it is stopped.
+// Send may still be called by a callback after Stop, so the channel is only closed
+// once no Send is in progress
+type Chan[T any] struct {
+	ch      chan T
+	done    chan struct{}
+	once    sync.Once
+	mux     sync.RWMutex
+	stopped bool
+}
+
+func NewChan[T any](size int) *Chan[T] {
+	return &Chan[T]{
+		ch:   make(chan T, size),
+		done: make(chan struct{}),
+	}
+}
+
+func (c *Chan[T]) C() <-chan T {
+	return c.ch
+}
+
+// Send blocks until the value is queued or the channel is stopped,
+// the value is dropped after Stop
+func (c *Chan[T]) Send(v T) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.stopped {
+		return
+	}
+	select {
+	case c.ch <- v:
+	case <-c.done:
+	}
+}
+
+// Stop unblocks the pending Send calls, calls the cancel functions which unregister the callbacks,
+// and then closes the channel
+func (c *Chan[T]) Stop(cancels ...func()) {
+	c.once.Do(func() {
+		close(c.done)
+		for _, cancel := range cancels {
+			cancel()
+		}
+		// the pending Send calls return as done is closed
+		c.mux.Lock()
+		c.stopped = true
+		close(c.ch)
+		c.mux.Unlock()
+	})
+}
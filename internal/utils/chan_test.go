@@ -0,0 +1,55 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package utils_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ahollic/socket.io/internal/utils"
+)
+
+func TestChanStopWhileSending(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		var handlers utils.HandlerList[int, int]
+		c := utils.NewChan[int](1)
+		cancel := handlers.On(func(a, _ int) {
+			c.Send(a)
+		})
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 50; k++ {
+					handlers.Call(k, 0)
+				}
+			}()
+		}
+		go func() {
+			for range c.C() {
+			}
+		}()
+		c.Stop(cancel)
+		wg.Wait()
+		// a snapshotted callback may still send after Stop
+		c.Send(-1)
+	}
+}
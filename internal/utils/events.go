@@ -89,19 +89,36 @@ func (l *HandlerList[A, B]) Once(cb func(A, B)) (cancel func()) {
 	return
 }
 
-func (l *HandlerList[A, B]) Call(a A, b B) {
+func (l *HandlerList[A, B]) Len() int {
 	l.mux.Lock()
 	defer l.mux.Unlock()
+	return len(l.callbacks)
+}
 
+// Call invokes the callbacks registered at the time of the call.
+// The callbacks run without holding the lock, so concurrent calls don't block each other,
+// and a callback may register or cancel callbacks
+func (l *HandlerList[A, B]) Call(a A, b B) {
+	l.mux.Lock()
+	if len(l.callbacks) == 0 {
+		l.mux.Unlock()
+		return
+	}
+	callbacks := make([]*EventCallback[A, B], len(l.callbacks))
+	copy(callbacks, l.callbacks)
 	for i := 0; i < len(l.callbacks); {
-		e := l.callbacks[i]
-		e.cb(a, b)
-		if e.once {
+		if l.callbacks[i].once {
 			n := len(l.callbacks) - 1
 			l.callbacks[i] = l.callbacks[n]
+			l.callbacks[n] = nil
 			l.callbacks = l.callbacks[:n]
 		} else {
 			i++
 		}
 	}
+	l.mux.Unlock()
+
+	for _, e := range callbacks {
+		e.cb(a, b)
+	}
 }
@@ -0,0 +1,60 @@
+//go:build go1.23
+
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"context"
+	"iter"
+
+	"github.com/ahollic/socket.io/internal/utils"
+)
+
+// Listen returns an iterator over the events of the namespace.
+// The iteration ends after yielding the error once an error is reported by OnError,
+// or the context is canceled. Breaking out of the loop unregisters the handlers,
+// the events received after that are not buffered
+func (s *Socket) Listen(ctx context.Context) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		events, stop := s.Events(0)
+		defer stop()
+		errs := utils.NewChan[error](1)
+		cancel := s.errorHandles.On(func(_ *Socket, err error) {
+			errs.Send(err)
+		})
+		defer errs.Stop(cancel)
+
+		for {
+			select {
+			case ev := <-events:
+				if !yield(ev, nil) {
+					return
+				}
+			case err := <-errs.C():
+				yield(Event{}, err)
+				return
+			case <-ctx.Done():
+				yield(Event{}, context.Cause(ctx))
+				return
+			}
+		}
+	}
+}
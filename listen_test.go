@@ -0,0 +1,74 @@
+//go:build go1.23
+
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ahollic/socket.io/socketiotest"
+)
+
+func TestListenBreak(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, c := connect(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if c.Emit("/", "tick", i) != nil {
+				return
+			}
+		}
+	}()
+	for ev, err := range s.Listen(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Name != "tick" {
+			t.Fatalf("unexpected event %q", ev.Name)
+		}
+		break
+	}
+	<-done
+
+	events, stop := s.Events(1)
+	defer stop()
+	if err := c.Emit("/", "after"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case ev := <-events:
+			if ev.Name == "after" {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("no event received after breaking out of Listen")
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// EventMarshaler is implemented by the event arguments which control their wire representation per event.
+// MarshalEvent returns the JSON encoding of the argument when it is emitted with the event
+type EventMarshaler interface {
+	MarshalEvent(event string) ([]byte, error)
+}
+
+type argEncoder = func(event string, v any) (any, error)
+
+// WithEncoder registers the encoder for the event arguments of type T,
+// the value it returns is sent instead and encoded with encoding/json.
+// It takes precedence over EventMarshaler
+func WithEncoder[T any](encoder func(event string, v T) (any, error)) Option {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	return func(s *Socket) {
+		if s.encoders == nil {
+			s.encoders = make(map[reflect.Type]argEncoder)
+		}
+		s.encoders[typ] = func(event string, v any) (any, error) {
+			return encoder(event, v.(T))
+		}
+	}
+}
+
+// marshalArgs applies the registered encoders and EventMarshaler to the arguments,
+// the given slice is not modified
+func (s *Socket) marshalArgs(event string, args []any) (_ []any, err error) {
+	var out []any
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		var v any
+		if enc, ok := s.encoders[reflect.TypeOf(arg)]; ok {
+			if v, err = enc(event, arg); err != nil {
+				return
+			}
+		} else if m, ok := arg.(EventMarshaler); ok {
+			var data []byte
+			if data, err = m.MarshalEvent(event); err != nil {
+				return
+			}
+			v = (json.RawMessage)(data)
+		} else {
+			continue
+		}
+		if out == nil {
+			out = append(([]any)(nil), args...)
+		}
+		out[i] = v
+	}
+	if out == nil {
+		return args, nil
+	}
+	return out, nil
+}
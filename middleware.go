@@ -0,0 +1,90 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDropEvent can be returned by an OutgoingMiddleware to drop the event silently
+var ErrDropEvent = errors.New("Socket.IO: event dropped by middleware")
+
+// OutgoingEvent is an event about to be emitted
+type OutgoingEvent struct {
+	Event string
+	Args  []any
+	// Ack reports whether the event expects an ack, changing it has no effect
+	Ack bool
+}
+
+// OutgoingMiddleware annotates, transforms or blocks an emitted event, it returns the event to continue with.
+// Middlewares run in the order they were added, until one of them returns an error
+type OutgoingMiddleware func(s *Socket, e OutgoingEvent) (OutgoingEvent, error)
+
+// MiddlewareError is returned by the emit methods when a middleware blocked the event
+type MiddlewareError struct {
+	Event string
+	Err   error
+}
+
+var _ error = (*MiddlewareError)(nil)
+
+func (e *MiddlewareError) Error() string {
+	return fmt.Sprintf("Socket.IO: event %q blocked by middleware: %v", e.Event, e.Err)
+}
+
+func (e *MiddlewareError) Unwrap() error {
+	return e.Err
+}
+
+type middlewareChain struct {
+	mux  sync.RWMutex
+	list []OutgoingMiddleware
+}
+
+func (c *middlewareChain) add(mw OutgoingMiddleware) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.list = append(c.list, mw)
+}
+
+func (c *middlewareChain) run(s *Socket, e OutgoingEvent) (OutgoingEvent, error) {
+	c.mux.RLock()
+	list := c.list
+	c.mux.RUnlock()
+	var err error
+	for _, mw := range list {
+		if e, err = mw(s, e); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// UseOutgoing adds the middleware of the emitted events, acks are not passed to it.
+// It runs before the arguments are encoded by the encoders and the payload codecs.
+// If it returns ErrDropEvent the event is not sent and Emit returns nil,
+// other errors are returned as *MiddlewareError. Since a dropped event would never be acked,
+// ErrDropEvent is also returned as *MiddlewareError by EmitWithAck
+func (s *Socket) UseOutgoing(mw OutgoingMiddleware) {
+	s.outgoing.add(mw)
+}
@@ -33,15 +33,29 @@ import (
 var (
 	errTooMuchArgs      = errors.New("Too much arguments were given")
 	errIncompletePacket = errors.New("Incomplete packet")
+	errNumberOverflow   = errors.New("Socket.IO: number in packet header is too large")
+	errTooManyAttachs   = errors.New("Socket.IO: packet declares too many attachments")
+)
+
+const (
+	// maxAttachments limits the attachment count declared by a received packet
+	maxAttachments = 1 << 16
+	// maxPacketNumber limits the attachment count and the ack id of a received packet
+	maxPacketNumber = 1<<31 - 1
 )
 
 type UnexpectedPacketTypeError struct {
 	Type PacketType
+	// Byte is the raw type byte of a decoded packet, Type is -1 in that case
+	Byte byte
 }
 
 var _ error = (*UnexpectedPacketTypeError)(nil)
 
 func (e *UnexpectedPacketTypeError) Error() string {
+	if e.Type == unknownType {
+		return fmt.Sprintf("Unexpected packet type %q", e.Byte)
+	}
 	return fmt.Sprintf("Unexpected packet type %d", e.Type)
 }
 
@@ -137,10 +151,38 @@ type Packet struct {
 	attachs   [][]byte
 }
 
+func NewPacket(typ PacketType, namespace string) *Packet {
+	return &Packet{
+		typ:       typ,
+		namespace: namespace,
+	}
+}
+
+// Clone returns a deep copy of the packet
+func (p *Packet) Clone() *Packet {
+	p2 := &Packet{
+		typ:       p.typ,
+		namespace: p.namespace,
+		id:        p.id,
+		data:      append(([]byte)(nil), p.data...),
+	}
+	if p.attachs != nil {
+		p2.attachs = make([][]byte, len(p.attachs))
+		for i, a := range p.attachs {
+			p2.attachs[i] = append(([]byte)(nil), a...)
+		}
+	}
+	return p2
+}
+
 func (p *Packet) Type() PacketType {
 	return p.typ
 }
 
+func (p *Packet) Namespace() string {
+	return p.namespace
+}
+
 func (p *Packet) String() string {
 	return fmt.Sprintf("Packet(%s, %q, %d, <%d bytes>)", p.typ.String(), p.namespace, p.id, len(p.data))
 }
@@ -157,6 +199,10 @@ func (p *Packet) SetData(args ...any) (err error) {
 	p.data = nil
 	p.attachs = p.attachs[:0]
 	if len(args) == 0 {
+		if p.typ == ACK {
+			// ack arguments must be an array
+			p.data = []byte("[]")
+		}
 		return
 	}
 	switch p.typ {
@@ -184,8 +230,7 @@ func (p *Packet) UnmarshalData(ptr any) (err error) {
 	if err = json.Unmarshal(p.data, ptr); err != nil {
 		return
 	}
-	p.decodeAttachs(ptr)
-	return
+	return p.decodeAttachs(ptr)
 }
 
 func (p *Packet) Attachments() [][]byte {
@@ -233,13 +278,23 @@ func (p *Packet) WriteTo(w io.Writer) (n int64, err error) {
 	return
 }
 
+// ParsePacket decodes a Socket.IO packet from the text frame data without modifying it.
+// Malformed input from an untrusted server only results an error, so it is safe to be used as a fuzz target
+func ParsePacket(data []byte) (*Packet, error) {
+	p := new(Packet)
+	if err := p.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func (p *Packet) UnmarshalBinary(data []byte) (err error) {
 	if len(data) == 0 {
 		return io.EOF
 	}
 	typ := pktTypeFromByte(data[0])
 	if typ == unknownType {
-		err = &UnexpectedPacketTypeError{typ}
+		err = &UnexpectedPacketTypeError{Type: typ, Byte: data[0]}
 		return
 	}
 	p.typ = typ
@@ -252,31 +307,32 @@ func (p *Packet) UnmarshalBinary(data []byte) (err error) {
 		return
 	}
 
-	var (
-		num int
-
-		attachLen int
-	)
-	num, data = readNumber(data)
-	if num >= 0 { // if read a number
-		if ok := len(data) > 0; ok && data[0] == '-' { // is <# of binary attachments>-
-			attachLen = num
-		} else { // assume it is <acknowledgment id>
-			p.id = num + 1
-			if ok {
-				goto READ_DATA
-			}
-			return
+	var attachLen int
+	num, rest, err := readNumber(data)
+	if err != nil {
+		return
+	}
+	if num >= 0 && len(rest) > 0 && rest[0] == '-' { // is <# of binary attachments>-
+		if num > maxAttachments {
+			return errTooManyAttachs
 		}
+		attachLen = num
+		data = rest[1:]
 	}
-	if data[0] == '/' { // is <namespace>,
+	if len(data) > 0 && data[0] == '/' { // is <namespace>,
 		i := bytes.IndexByte(data, ',')
 		if i < 0 {
 			return io.EOF
 		}
 		p.namespace, data = (string)(data[:i]), data[i+1:]
 	}
-READ_DATA:
+	if num, rest, err = readNumber(data); err != nil {
+		return
+	}
+	if num >= 0 { // is <acknowledgment id>
+		p.id = num + 1
+		data = rest
+	}
 	p.data = append(p.data, data...)
 	if cap(p.attachs) >= attachLen {
 		p.attachs = p.attachs[:attachLen]
@@ -286,9 +342,9 @@ READ_DATA:
 	return
 }
 
-func readNumber(data []byte) (num int, rest []byte) {
+func readNumber(data []byte) (num int, rest []byte, err error) {
 	if len(data) == 0 || data[0] < '0' || '9' < data[0] {
-		return -1, data
+		return -1, data, nil
 	}
 	for {
 		if len(data) == 0 {
@@ -300,6 +356,8 @@ func readNumber(data []byte) (num int, rest []byte) {
 			return
 		}
 		data = data[1:]
-		num = num*10 + (int)(b-'0')
+		if num = num*10 + (int)(b-'0'); num > maxPacketNumber {
+			return -1, nil, errNumberOverflow
+		}
 	}
 }
@@ -0,0 +1,60 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package socket_test
+
+import (
+	"bytes"
+	"testing"
+
+	socket "github.com/ahollic/socket.io"
+)
+
+func FuzzParsePacket(f *testing.F) {
+	for _, seed := range []string{
+		`0{"token":"abc"}`,
+		`0/admin,{"sid":"abc"}`,
+		"1/chat,",
+		`2["hello",1,{"a":true}]`,
+		`2/chat,12["ev","arg"]`,
+		`312["ok"]`,
+		`4{"message":"not authorized"}`,
+		`51-/chat,12["ev",{"_placeholder":true,"num":0}]`,
+		`2["ev",{"_placeholder":true,"num":3}]`,
+		`699999999999-["ev"]`,
+		"2/chat",
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		orig := bytes.Clone(data)
+		pkt, err := socket.ParsePacket(data)
+		if !bytes.Equal(data, orig) {
+			t.Fatalf("ParsePacket modified its input %q to %q", orig, data)
+		}
+		if err != nil {
+			return
+		}
+		// the placeholders may refer to missing attachments, which must be reported as errors
+		var args []any
+		pkt.UnmarshalData(&args)
+		var bufs []socket.Buffer
+		pkt.UnmarshalData(&bufs)
+	})
+}
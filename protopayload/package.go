@@ -0,0 +1,31 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// package protopayload implements event payloads of serialized messages, e.g. protobuf,
+// carried as binary attachments.
+// It does not depend on a protobuf runtime, the serialization is provided by a Marshaler:
+//
+//	reg := protopayload.NewRegistry(protopayload.Funcs{
+//		MarshalFunc:   func(m any) ([]byte, error) { return proto.Marshal(m.(proto.Message)) },
+//		UnmarshalFunc: func(b []byte, m any) error { return proto.Unmarshal(b, m.(proto.Message)) },
+//	})
+//	protopayload.Register[*pb.ChatMessage](reg, "chat")
+//	protopayload.On(reg, sock, "chat", func(msg *pb.ChatMessage) { ... })
+//	reg.Emit(sock, "chat", &pb.ChatMessage{Text: "hi"})
+package protopayload
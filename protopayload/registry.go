@@ -0,0 +1,190 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package protopayload
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	socket "github.com/ahollic/socket.io"
+)
+
+// Marshaler serializes the messages
+type Marshaler interface {
+	Marshal(msg any) ([]byte, error)
+	Unmarshal(data []byte, msg any) error
+}
+
+// Funcs is a Marshaler of functions
+type Funcs struct {
+	MarshalFunc   func(msg any) ([]byte, error)
+	UnmarshalFunc func(data []byte, msg any) error
+}
+
+var _ Marshaler = Funcs{}
+
+func (f Funcs) Marshal(msg any) ([]byte, error) {
+	return f.MarshalFunc(msg)
+}
+
+func (f Funcs) Unmarshal(data []byte, msg any) error {
+	return f.UnmarshalFunc(data, msg)
+}
+
+// UnregisteredEventError is returned when no message type was registered for the event
+type UnregisteredEventError struct {
+	Event string
+}
+
+var _ error = (*UnregisteredEventError)(nil)
+
+func (e *UnregisteredEventError) Error() string {
+	return fmt.Sprintf("protopayload: no message type registered for event %q", e.Event)
+}
+
+// TypeMismatchError is returned when the message does not have the type registered for the event
+type TypeMismatchError struct {
+	Event     string
+	Want, Got reflect.Type
+}
+
+var _ error = (*TypeMismatchError)(nil)
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("protopayload: event %q expects %v, got %v", e.Event, e.Want, e.Got)
+}
+
+// Registry maps the event names to their message types
+type Registry struct {
+	marshaler Marshaler
+
+	mux   sync.RWMutex
+	types map[string]reflect.Type
+
+	// OnError is called when a received message cannot be decoded
+	OnError func(event string, err error)
+}
+
+func NewRegistry(marshaler Marshaler) *Registry {
+	return &Registry{
+		marshaler: marshaler,
+		types:     make(map[string]reflect.Type),
+	}
+}
+
+// Register registers T as the message type of the event, T must be a pointer type
+func Register[T any](r *Registry, event string) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Pointer {
+		panic(fmt.Errorf("protopayload: message type %v must be a pointer", typ))
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.types[event] = typ
+}
+
+// Type returns the registered message type of the event
+func (r *Registry) Type(event string) (typ reflect.Type, ok bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	typ, ok = r.types[event]
+	return
+}
+
+func (r *Registry) check(event string, msg any) error {
+	typ, ok := r.Type(event)
+	if !ok {
+		return &UnregisteredEventError{Event: event}
+	}
+	if got := reflect.TypeOf(msg); got != typ {
+		return &TypeMismatchError{Event: event, Want: typ, Got: got}
+	}
+	return nil
+}
+
+// Encode serializes the message of the event to a binary attachment
+func (r *Registry) Encode(event string, msg any) (*socket.Buffer, error) {
+	if err := r.check(event, msg); err != nil {
+		return nil, err
+	}
+	data, err := r.marshaler.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &socket.Buffer{B: data}, nil
+}
+
+// Decode deserializes the message of the event from its argument
+func (r *Registry) Decode(event string, arg socket.Arg) (msg any, err error) {
+	typ, ok := r.Type(event)
+	if !ok {
+		return nil, &UnregisteredEventError{Event: event}
+	}
+	var buf socket.Buffer
+	if err = arg.As(&buf); err != nil {
+		return
+	}
+	msg = reflect.New(typ.Elem()).Interface()
+	if err = r.marshaler.Unmarshal(buf.B, msg); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Emit emits the event with the message as a binary attachment, followed by the extra arguments
+func (r *Registry) Emit(s *socket.Socket, event string, msg any, extra ...any) error {
+	buf, err := r.Encode(event, msg)
+	if err != nil {
+		return err
+	}
+	return s.Emit(event, append([]any{buf}, extra...)...)
+}
+
+// On registers the callback which receives the messages of the event,
+// the event must be registered with the message type T
+func On[T any](r *Registry, s *socket.Socket, event string, cb func(msg T)) {
+	s.OnRawMessage(func(name string, args []socket.Arg) {
+		if name != event {
+			return
+		}
+		if len(args) == 0 {
+			r.onError(event, &socket.ArgCountError{Want: 1, Got: 0})
+			return
+		}
+		msg, err := r.Decode(event, args[0])
+		if err != nil {
+			r.onError(event, err)
+			return
+		}
+		v, ok := msg.(T)
+		if !ok {
+			r.onError(event, &TypeMismatchError{Event: event, Want: reflect.TypeOf((*T)(nil)).Elem(), Got: reflect.TypeOf(msg)})
+			return
+		}
+		cb(v)
+	})
+}
+
+func (r *Registry) onError(event string, err error) {
+	if r.OnError != nil {
+		r.OnError(event, err)
+	}
+}
@@ -0,0 +1,383 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahollic/socket.io/internal/utils"
+)
+
+// ReliableEvent is the event name used by Reliable,
+// the arguments are (id, event, args...) and the receiver must ack it
+const ReliableEvent = "$reliable"
+
+// DefaultDedupWindow is the number of recent message ids remembered by the receiver
+const DefaultDedupWindow = 1024
+
+const (
+	// reliableRetryDelay is the first delay before an event is sent again after its ack timed out
+	reliableRetryDelay    = time.Second
+	reliableMaxRetryDelay = time.Minute
+)
+
+// ReliableStore persists the events of a Reliable until they are acked,
+// so they are sent again after the process restarted
+type ReliableStore interface {
+	// Save stores an emitted event
+	Save(e StoredEvent) error
+	// Delete removes the event after it was acked
+	Delete(id string) error
+	// Load returns the stored events in the order they were saved
+	Load() ([]StoredEvent, error)
+}
+
+// StoredEvent is an event saved in a ReliableStore,
+// the args must be restorable by the store, e.g. marshalable to JSON
+type StoredEvent struct {
+	// ID identifies the event at the receiver, it is kept across restarts for the deduplication
+	ID    string
+	Event string
+	Args  []any
+}
+
+// Reliable provides at-least-once delivery on top of a Socket.
+// Emitted events are kept until the peer acked them. They are sent again with backoff when the ack timed out,
+// and after reconnect. Received events are deduplicated by their ids within a sliding window
+type Reliable struct {
+	s       *Socket
+	session string
+	ordered bool
+	store   ReliableStore
+
+	// sendMux keeps the events in order while Emit and resend send them
+	sendMux sync.Mutex
+	// connected is set after the pending events were sent again on connect
+	connected atomic.Bool
+
+	mux     sync.Mutex
+	seq     uint64
+	order   uint64
+	pending map[string]*reliableEvent
+
+	seenMux  sync.Mutex
+	seen     map[string]struct{}
+	seenRing []string
+	seenPos  int
+
+	// streams are the receive states of the senders in ordered mode
+	orderMux sync.Mutex
+	streams  map[string]*orderedStream
+
+	messageHandlers utils.HandlerList[string, []any]
+}
+
+type orderedStream struct {
+	next    uint64
+	pending map[uint64]orderedEvent
+}
+
+type orderedEvent struct {
+	event string
+	args  []any
+}
+
+type reliableEvent struct {
+	id    string
+	order uint64 // the local emit order, used to send the events again in order
+	event string
+	args  []any
+}
+
+// NewReliable creates a Reliable on the socket, window is the size of the dedup window,
+// DefaultDedupWindow will be used if it is not positive
+func NewReliable(s *Socket, window int) (r *Reliable) {
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	var session [8]byte
+	rand.Read(session[:])
+	r = &Reliable{
+		s:        s,
+		session:  hex.EncodeToString(session[:]),
+		pending:  make(map[string]*reliableEvent),
+		seen:     make(map[string]struct{}, window),
+		seenRing: make([]string, window),
+	}
+	r.connected.Store(s.Status() == SocketConnected)
+	s.OnConnect(func(*Socket, string) {
+		// Emit may be waiting for the send window while holding sendMux, which is freed by the reader
+		go r.resend()
+	})
+	s.OnDisconnect(func(*Socket, string) {
+		r.connected.Store(false)
+	})
+	s.onReceivedEvent(func(s *Socket, e *receivedEvent) {
+		r.onEvent(e)
+	})
+	return
+}
+
+// NewOrdered is like NewReliable, but events are delivered to the OnMessage callbacks
+// in the order they were emitted by each sender, even if retries and reconnects reordered them
+func NewOrdered(s *Socket, window int) (r *Reliable) {
+	r = NewReliable(s, window)
+	r.ordered = true
+	r.streams = make(map[string]*orderedStream)
+	return
+}
+
+// SetStore persists the pending events with store, the events already in the store are queued
+// and will be sent once connected. The error of loading the events is returned
+func (r *Reliable) SetStore(store ReliableStore) error {
+	events, err := store.Load()
+	r.mux.Lock()
+	r.store = store
+	for _, se := range events {
+		if _, ok := r.pending[se.ID]; ok {
+			continue
+		}
+		r.order++
+		r.pending[se.ID] = &reliableEvent{
+			id:    se.ID,
+			order: r.order,
+			event: se.Event,
+			args:  se.Args,
+		}
+	}
+	r.mux.Unlock()
+	if len(events) > 0 && r.connected.Load() {
+		go r.resend()
+	}
+	return err
+}
+
+// Emit queues the event until it is acked by the peer,
+// the error of saving it to the ReliableStore is reported to the OnError callbacks of the socket
+func (r *Reliable) Emit(event string, args ...any) {
+	r.sendMux.Lock()
+	defer r.sendMux.Unlock()
+
+	r.mux.Lock()
+	r.seq++
+	r.order++
+	e := &reliableEvent{
+		id:    r.session + "-" + strconv.FormatUint(r.seq, 10),
+		order: r.order,
+		event: event,
+		args:  args,
+	}
+	r.pending[e.id] = e
+	store := r.store
+	r.mux.Unlock()
+	if store != nil {
+		if err := store.Save(StoredEvent{ID: e.id, Event: e.event, Args: e.args}); err != nil {
+			r.s.onError(err)
+		}
+	}
+	if r.connected.Load() {
+		r.send(e)
+	}
+}
+
+// Pending returns the number of events waiting for their acks
+func (r *Reliable) Pending() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.pending)
+}
+
+// OnMessage registers the callback for deduplicated reliable events
+func (r *Reliable) OnMessage(cb func(event string, args []any)) {
+	r.messageHandlers.On(cb)
+}
+
+func (r *Reliable) resend() {
+	r.sendMux.Lock()
+	defer r.sendMux.Unlock()
+
+	r.mux.Lock()
+	events := make([]*reliableEvent, 0, len(r.pending))
+	for _, e := range r.pending {
+		events = append(events, e)
+	}
+	r.mux.Unlock()
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].order < events[j].order
+	})
+	for _, e := range events {
+		r.send(e)
+	}
+	r.connected.Store(r.s.Status() == SocketConnected)
+}
+
+// send emits the event and waits for its ack in background, sendMux must be held
+func (r *Reliable) send(e *reliableEvent) {
+	ctx := r.s.Context()
+	ack, err := r.emit(ctx, e)
+	if err != nil {
+		// will be sent again after reconnect
+		return
+	}
+	go r.waitAck(ctx, e, ack)
+}
+
+func (r *Reliable) emit(ctx context.Context, e *reliableEvent) (*pendingAck, error) {
+	args := make([]any, 0, 2+len(e.args))
+	args = append(args, e.id, e.event)
+	args = append(args, e.args...)
+	return r.s.emitWithAck(ctx, ReliableEvent, args, r.s.ackTimeout)
+}
+
+// waitAck waits for the ack of the event, and sends the event again with backoff when the ack timed out.
+// It stops when ctx is canceled, the event will then be sent again after reconnect
+func (r *Reliable) waitAck(ctx context.Context, e *reliableEvent, ack *pendingAck) {
+	delay := reliableRetryDelay
+	for {
+		_, err := r.s.waitAck(ctx, ack)
+		if err == nil {
+			break
+		}
+		var te *AckTimeoutError
+		if !errors.As(err, &te) {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		if delay < reliableMaxRetryDelay {
+			delay = min(delay*2, reliableMaxRetryDelay)
+		}
+		r.sendMux.Lock()
+		r.mux.Lock()
+		_, ok := r.pending[e.id]
+		r.mux.Unlock()
+		if ok {
+			ack, err = r.emit(ctx, e)
+		}
+		r.sendMux.Unlock()
+		if !ok || err != nil {
+			return
+		}
+	}
+
+	r.mux.Lock()
+	_, ok := r.pending[e.id]
+	delete(r.pending, e.id)
+	store := r.store
+	r.mux.Unlock()
+	if ok && store != nil {
+		if err := store.Delete(e.id); err != nil {
+			r.s.onError(err)
+		}
+	}
+}
+
+func (r *Reliable) onEvent(e *receivedEvent) {
+	if e.name != ReliableEvent || len(e.args) < 2 {
+		return
+	}
+	arr, err := e.values()
+	if err != nil {
+		return
+	}
+	id, ok1 := arr[0].(string)
+	event, ok2 := arr[1].(string)
+	if !ok1 || !ok2 {
+		return
+	}
+	if e.id >= 0 {
+		r.s.sendAck(e.namespace, e.id)
+	}
+	if r.ordered {
+		r.deliverOrdered(id, event, arr[2:])
+		return
+	}
+	if !r.markSeen(id) {
+		return
+	}
+	r.messageHandlers.Call(event, arr[2:])
+}
+
+// deliverOrdered buffers the event until all previous events of the sender were delivered
+func (r *Reliable) deliverOrdered(id string, event string, args []any) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 {
+		return
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return
+	}
+	session := id[:i]
+
+	r.orderMux.Lock()
+	defer r.orderMux.Unlock()
+	st := r.streams[session]
+	if st == nil {
+		st = &orderedStream{
+			next:    1,
+			pending: make(map[uint64]orderedEvent),
+		}
+		r.streams[session] = st
+	}
+	if seq < st.next {
+		return
+	}
+	st.pending[seq] = orderedEvent{event, args}
+	for {
+		e, ok := st.pending[st.next]
+		if !ok {
+			break
+		}
+		delete(st.pending, st.next)
+		st.next++
+		r.messageHandlers.Call(e.event, e.args)
+	}
+}
+
+// markSeen reports whether the id is new, and remembers it
+func (r *Reliable) markSeen(id string) bool {
+	r.seenMux.Lock()
+	defer r.seenMux.Unlock()
+	if _, ok := r.seen[id]; ok {
+		return false
+	}
+	if old := r.seenRing[r.seenPos]; old != "" {
+		delete(r.seen, old)
+	}
+	r.seenRing[r.seenPos] = id
+	r.seenPos = (r.seenPos + 1) % len(r.seenRing)
+	r.seen[id] = struct{}{}
+	return true
+}
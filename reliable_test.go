@@ -0,0 +1,130 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	socket "github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/socketiotest"
+)
+
+// waitPending waits until the Reliable has no events waiting for their acks
+func waitPending(t *testing.T, ctx context.Context, r *socket.Reliable) {
+	t.Helper()
+	for r.Pending() != 0 {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatalf("%d events are still pending", r.Pending())
+		}
+	}
+}
+
+func TestReliableRetriesOnAckTimeout(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	s, _ := connect(t, srv, socket.WithAckTimeout(100*time.Millisecond))
+	r := socket.NewReliable(s, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.Emit("greet", "hi")
+	first, err := srv.WaitEvent(ctx, socket.ReliableEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ack is not sent, the event must be sent again on the same connection
+	retry, err := srv.WaitEvent(ctx, socket.ReliableEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(retry.Args[0]) != string(first.Args[0]) {
+		t.Fatalf("the retry has id %s, want %s", retry.Args[0], first.Args[0])
+	}
+	if err := retry.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	waitPending(t, ctx, r)
+}
+
+type memoryStore struct {
+	mux     sync.Mutex
+	events  []socket.StoredEvent
+	deleted []string
+}
+
+func (m *memoryStore) Save(e socket.StoredEvent) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *memoryStore) Delete(id string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+func (m *memoryStore) Load() ([]socket.StoredEvent, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append(([]socket.StoredEvent)(nil), m.events...), nil
+}
+
+func TestReliableStore(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	srv.Handle(socket.ReliableEvent, func(*socketiotest.Conn, []json.RawMessage) []any {
+		return nil
+	})
+	s, _ := connect(t, srv)
+	r := socket.NewReliable(s, 0)
+	store := &memoryStore{
+		events: []socket.StoredEvent{{ID: "previous-1", Event: "greet", Args: []any{"restored"}}},
+	}
+	if err := r.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e, err := srv.WaitEvent(ctx, socket.ReliableEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e.Args[0]) != `"previous-1"` || string(e.Args[2]) != `"restored"` {
+		t.Fatalf("received the stored event as %s", e.Args)
+	}
+	r.Emit("greet", "new")
+	waitPending(t, ctx, r)
+
+	store.mux.Lock()
+	defer store.mux.Unlock()
+	if len(store.events) != 2 || len(store.deleted) != 2 {
+		t.Fatalf("store has %d saved and %d deleted events, want 2 and 2", len(store.events), len(store.deleted))
+	}
+}
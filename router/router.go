@@ -0,0 +1,249 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	socket "github.com/ahollic/socket.io"
+)
+
+// Context is passed to the handlers of a routed event
+type Context struct {
+	context.Context
+	Socket *socket.Socket
+	Event  string
+	Params map[string]string
+	Args   []any
+}
+
+// Param returns the value of a path parameter, or an empty string if it does not exist
+func (c *Context) Param(name string) string {
+	return c.Params[name]
+}
+
+// Bind decodes the i-th argument into v
+func (c *Context) Bind(i int, v any) error {
+	if i >= len(c.Args) {
+		return fmt.Errorf("Socket.IO: event %q has no argument %d", c.Event, i)
+	}
+	buf, err := json.Marshal(c.Args[i])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+type HandlerFunc = func(c *Context) error
+
+type Middleware = func(next HandlerFunc) HandlerFunc
+
+// Typed returns a handler which decodes the first argument as the payload
+func Typed[T any](h func(c *Context, payload T) error) HandlerFunc {
+	return func(c *Context) error {
+		var payload T
+		if len(c.Args) > 0 {
+			if err := c.Bind(0, &payload); err != nil {
+				return err
+			}
+		}
+		return h(c, payload)
+	}
+}
+
+// Group is a set of routes sharing a prefix and middlewares
+type Group struct {
+	router      *Router
+	parent      *Group
+	prefix      string
+	middlewares []Middleware
+}
+
+type route struct {
+	segments []string
+	group    *Group
+	handler  HandlerFunc
+}
+
+// Router matches the event names against the registered patterns in registration order.
+// A segment ":name" matches a single segment, a last segment "*name" matches the rest of the event name
+type Router struct {
+	root Group
+
+	mux      sync.RWMutex
+	routes   []*route
+	notFound HandlerFunc
+	onError  func(c *Context, err error)
+}
+
+func New() (r *Router) {
+	r = new(Router)
+	r.root.router = r
+	return
+}
+
+// Use appends middlewares which apply to all routes
+func (r *Router) Use(mw ...Middleware) {
+	r.root.Use(mw...)
+}
+
+func (r *Router) Group(prefix string, mw ...Middleware) *Group {
+	return r.root.Group(prefix, mw...)
+}
+
+func (r *Router) Handle(pattern string, h HandlerFunc) {
+	r.root.Handle(pattern, h)
+}
+
+// Use appends middlewares to the group, they also apply to routes registered before
+func (g *Group) Use(mw ...Middleware) {
+	g.router.mux.Lock()
+	defer g.router.mux.Unlock()
+	g.middlewares = append(g.middlewares, mw...)
+}
+
+// Group creates a sub group, the prefix is joined to the parent's prefix with a '/'
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		router:      g.router,
+		parent:      g,
+		prefix:      joinPath(g.prefix, prefix),
+		middlewares: mw,
+	}
+}
+
+// Handle registers the handler for the pattern under the group's prefix
+func (g *Group) Handle(pattern string, h HandlerFunc) {
+	r := g.router
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.routes = append(r.routes, &route{
+		segments: strings.Split(joinPath(g.prefix, pattern), "/"),
+		group:    g,
+		handler:  h,
+	})
+}
+
+// NotFound sets the handler of events which match no route
+func (r *Router) NotFound(h HandlerFunc) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.notFound = h
+}
+
+// OnError sets the callback of errors returned by the handlers
+func (r *Router) OnError(cb func(c *Context, err error)) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.onError = cb
+}
+
+// Attach routes the events received by the socket
+func (r *Router) Attach(s *socket.Socket) {
+	s.OnMessageContext(func(ctx context.Context, event string, args []any) {
+		r.Dispatch(&Context{
+			Context: ctx,
+			Socket:  s,
+			Event:   event,
+			Args:    args,
+		})
+	})
+}
+
+// Dispatch finds the route of c.Event and runs it with the middlewares.
+// It reports whether a route or the NotFound handler was found
+func (r *Router) Dispatch(c *Context) bool {
+	segments := strings.Split(c.Event, "/")
+	r.mux.RLock()
+	var (
+		h  HandlerFunc
+		g  *Group
+		ps map[string]string
+	)
+	for _, rt := range r.routes {
+		if params, ok := rt.match(segments); ok {
+			h, g, ps = rt.handler, rt.group, params
+			break
+		}
+	}
+	if h == nil {
+		h, g = r.notFound, &r.root
+	}
+	if h == nil {
+		r.mux.RUnlock()
+		return false
+	}
+	for ; g != nil; g = g.parent {
+		for i := len(g.middlewares) - 1; i >= 0; i-- {
+			h = g.middlewares[i](h)
+		}
+	}
+	onError := r.onError
+	r.mux.RUnlock()
+
+	c.Params = ps
+	if err := h(c); err != nil && onError != nil {
+		onError(c, err)
+	}
+	return true
+}
+
+func (rt *route) match(segments []string) (params map[string]string, ok bool) {
+	for i, seg := range rt.segments {
+		if len(seg) > 0 && seg[0] == '*' {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if len(seg) > 0 && seg[0] == ':' {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = segments[i]
+		} else if seg != segments[i] {
+			return nil, false
+		}
+	}
+	if len(rt.segments) != len(segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+func joinPath(prefix, p string) string {
+	prefix = strings.Trim(prefix, "/")
+	p = strings.Trim(p, "/")
+	if prefix == "" {
+		return p
+	}
+	if p == "" {
+		return prefix
+	}
+	return prefix + "/" + p
+}
@@ -0,0 +1,105 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// RPCError is the error returned by a remote RPC handler
+type RPCError struct {
+	Method  string `json:"-"`
+	Message string `json:"message"`
+}
+
+var _ error = (*RPCError)(nil)
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("Socket.IO: rpc %s: %s", e.Method, e.Message)
+}
+
+// Register handles the RPC calls of method, which are events with an ack.
+// The ack arguments are (error, response), error is null or {"message": string}.
+// The handler runs in a new goroutine, ctx is canceled when the socket disconnected
+func Register[TReq, TResp any](s *Socket, method string, handler func(ctx context.Context, req TReq) (TResp, error)) {
+	s.onReceivedEvent(func(s *Socket, e *receivedEvent) {
+		if e.id < 0 || e.name != method {
+			return
+		}
+		var req TReq
+		var decodeErr error
+		if len(e.args) > 0 {
+			decodeErr = e.args[0].As(&req)
+		}
+		namespace, id := e.namespace, e.id
+		ctx := s.Context()
+		go func() {
+			if decodeErr != nil {
+				s.sendAck(namespace, id, &RPCError{Message: decodeErr.Error()})
+				return
+			}
+			resp, err := handler(ctx, req)
+			if err != nil {
+				s.sendAck(namespace, id, &RPCError{Message: err.Error()})
+				return
+			}
+			s.sendAck(namespace, id, nil, resp)
+		}()
+	})
+}
+
+// Call emits method with req and waits for the response registered by Register on the other side
+func Call[TReq, TResp any](ctx context.Context, s *Socket, method string, req TReq) (resp TResp, err error) {
+	args, err := s.EmitWithAckContext(ctx, method, req)
+	if err != nil {
+		return
+	}
+	if len(args) > 0 && args[0] != nil {
+		rerr := &RPCError{Method: method}
+		if m, ok := args[0].(map[string]any); ok {
+			rerr.Message, _ = m["message"].(string)
+		} else {
+			rerr.Message = fmt.Sprint(args[0])
+		}
+		return resp, rerr
+	}
+	if len(args) > 1 {
+		var buf []byte
+		if buf, err = json.Marshal(args[1]); err != nil {
+			return
+		}
+		err = json.Unmarshal(buf, &resp)
+	}
+	return
+}
+
+func (s *Socket) sendAck(namespace string, id int, args ...any) error {
+	pkt := &Packet{
+		typ:       ACK,
+		namespace: namespace,
+	}
+	pkt.SetId(id)
+	if err := pkt.SetData(args...); err != nil {
+		return err
+	}
+	return s.send(pkt)
+}
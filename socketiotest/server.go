@@ -0,0 +1,445 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socketiotest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahollic/socket.io"
+	"github.com/ahollic/socket.io/engine.io"
+	"github.com/gorilla/websocket"
+)
+
+var ErrConnClosed = errors.New("socketiotest: connection closed")
+
+// EventHandler is called when the client emits the event,
+// the returned values will be sent back as the ack if the client requested one
+type EventHandler = func(c *Conn, args []json.RawMessage) []any
+
+// Server is a minimal Engine.IO v4 / Socket.IO v5 server over websocket.
+// It accepts any path, so it can be used with any engine.Options.Path
+type Server struct {
+	*httptest.Server
+
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// OnConnect is called when a client connects to a namespace,
+	// a non-nil error will be sent as CONNECT_ERROR
+	OnConnect func(c *Conn, namespace string, auth json.RawMessage) error
+
+	upgrader websocket.Upgrader
+	sidCount atomic.Int64
+
+	mux      sync.Mutex
+	handlers map[string]EventHandler
+	conns    []*Conn
+	connCh   chan *Conn
+	events   []*Event
+	notify   chan struct{}
+}
+
+// NewServer starts and returns a new Server
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a new Server which is not started yet
+func NewUnstartedServer() *Server {
+	s := &Server{
+		PingInterval: 25 * time.Second,
+		PingTimeout:  20 * time.Second,
+		handlers:     make(map[string]EventHandler),
+		connCh:       make(chan *Conn, 16),
+		notify:       make(chan struct{}),
+	}
+	s.Server = httptest.NewUnstartedServer(s)
+	return s
+}
+
+// Options returns engine options that will dial to this server
+func (s *Server) Options() engine.Options {
+	return engine.Options{
+		Host: s.URL,
+		Path: "/socket.io/",
+	}
+}
+
+// Handle registers the handler for the event
+func (s *Server) Handle(event string, handler EventHandler) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.handlers[event] = handler
+}
+
+// Conns returns the connections that have been accepted
+func (s *Server) Conns() []*Conn {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append(([]*Conn)(nil), s.conns...)
+}
+
+// Accept waits for the next Engine.IO connection
+func (s *Server) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-s.connCh:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// WaitEvent waits and removes the first received event with the name,
+// an empty name matches any event
+func (s *Server) WaitEvent(ctx context.Context, name string) (*Event, error) {
+	for {
+		s.mux.Lock()
+		for i, e := range s.events {
+			if name == "" || e.Name == name {
+				s.events = append(s.events[:i], s.events[i+1:]...)
+				s.mux.Unlock()
+				return e, nil
+			}
+		}
+		notify := s.notify
+		s.mux.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Server) pushEvent(e *Event) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.events = append(s.events, e)
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("transport") != engine.TransportWebsocket {
+		http.Error(rw, "socketiotest: only websocket transport is supported", http.StatusBadRequest)
+		return
+	}
+	wsconn, err := s.upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		return
+	}
+	c := &Conn{
+		server:  s,
+		Request: req,
+		Sid:     "sid-" + strconv.FormatInt(s.sidCount.Add(1), 10),
+		wsconn:  wsconn,
+		closed:  make(chan struct{}),
+		ackChan: make(map[int]chan []json.RawMessage),
+	}
+	open, _ := json.Marshal(map[string]any{
+		"sid":          c.Sid,
+		"upgrades":     []string{},
+		"pingInterval": s.PingInterval.Milliseconds(),
+		"pingTimeout":  s.PingTimeout.Milliseconds(),
+		"maxPayload":   1000000,
+	})
+	if err := c.writeEngine(engine.OPEN, open); err != nil {
+		wsconn.Close()
+		return
+	}
+	s.mux.Lock()
+	s.conns = append(s.conns, c)
+	s.mux.Unlock()
+	select {
+	case s.connCh <- c:
+	default:
+	}
+	go c.pinger()
+	c.reader()
+}
+
+// Event is an event emitted by the client
+type Event struct {
+	Conn      *Conn
+	Namespace string
+	Name      string
+	Args      []json.RawMessage
+	// Attachments are the binary attachments of a BINARY_EVENT,
+	// placeholders in Args refer to them by index
+	Attachments [][]byte
+
+	ackId int
+}
+
+// WantAck reports whether the client is waiting for an ack
+func (e *Event) WantAck() bool {
+	return e.ackId >= 0
+}
+
+// Ack sends the ack of the event
+func (e *Event) Ack(args ...any) error {
+	if e.ackId < 0 {
+		return errors.New("socketiotest: event does not require an ack")
+	}
+	return e.Conn.sendAck(e.Namespace, e.ackId, args)
+}
+
+// Conn is an Engine.IO connection accepted by the Server
+type Conn struct {
+	server  *Server
+	Request *http.Request
+	Sid     string
+
+	writeMux sync.Mutex
+	wsconn   *websocket.Conn
+	closed   chan struct{}
+	once     sync.Once
+
+	ackMux  sync.Mutex
+	ackId   int
+	ackChan map[int]chan []json.RawMessage
+}
+
+// Closed returns a channel which will be closed after the connection is closed
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) writeEngine(typ engine.PacketType, body []byte) error {
+	data := make([]byte, 1+len(body))
+	data[0] = typ.ID()
+	copy(data[1:], body)
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	return c.wsconn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Conn) writePacket(pkt *socket.Packet) error {
+	var buf bytes.Buffer
+	buf.WriteByte(engine.MESSAGE.ID())
+	if _, err := pkt.WriteTo(&buf); err != nil {
+		return err
+	}
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	if err := c.wsconn.WriteMessage(websocket.TextMessage, buf.Bytes()); err != nil {
+		return err
+	}
+	for _, a := range pkt.Attachments() {
+		if err := c.wsconn.WriteMessage(websocket.BinaryMessage, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) pinger() {
+	ticker := time.NewTicker(c.server.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.writeEngine(engine.PING, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Conn) reader() {
+	defer c.Drop()
+	var (
+		binPkt  *socket.Packet
+		binRecv int
+	)
+	for {
+		code, data, err := c.wsconn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if code == websocket.BinaryMessage {
+			if binPkt == nil {
+				continue
+			}
+			binPkt.Attachments()[binRecv] = data
+			binRecv++
+			if binRecv == len(binPkt.Attachments()) {
+				c.onPacket(binPkt)
+				binPkt = nil
+			}
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+		switch data[0] {
+		case engine.CLOSE.ID():
+			return
+		case engine.MESSAGE.ID():
+			var pkt socket.Packet
+			if err := pkt.UnmarshalBinary(data[1:]); err != nil {
+				return
+			}
+			if len(pkt.Attachments()) > 0 {
+				binPkt, binRecv = &pkt, 0
+				continue
+			}
+			c.onPacket(&pkt)
+		}
+	}
+}
+
+func (c *Conn) onPacket(pkt *socket.Packet) {
+	switch pkt.Type() {
+	case socket.CONNECT:
+		var auth json.RawMessage
+		pkt.UnmarshalData(&auth)
+		if h := c.server.OnConnect; h != nil {
+			if err := h(c, pkt.Namespace(), auth); err != nil {
+				res := socket.NewPacket(socket.CONNECT_ERROR, pkt.Namespace())
+				res.SetData(map[string]any{
+					"message": err.Error(),
+				})
+				c.writePacket(res)
+				return
+			}
+		}
+		res := socket.NewPacket(socket.CONNECT, pkt.Namespace())
+		res.SetData(map[string]any{
+			"sid": c.Sid,
+		})
+		c.writePacket(res)
+	case socket.EVENT, socket.BINARY_EVENT:
+		var arr []json.RawMessage
+		if err := pkt.UnmarshalData(&arr); err != nil || len(arr) == 0 {
+			return
+		}
+		e := &Event{
+			Conn:        c,
+			Namespace:   pkt.Namespace(),
+			Args:        arr[1:],
+			Attachments: pkt.Attachments(),
+			ackId:       pkt.Id(),
+		}
+		if err := json.Unmarshal(arr[0], &e.Name); err != nil {
+			return
+		}
+		c.server.mux.Lock()
+		handler := c.server.handlers[e.Name]
+		c.server.mux.Unlock()
+		if handler != nil {
+			res := handler(c, e.Args)
+			if e.WantAck() {
+				e.Ack(res...)
+				e.ackId = -1
+			}
+		}
+		c.server.pushEvent(e)
+	case socket.ACK, socket.BINARY_ACK:
+		var arr []json.RawMessage
+		pkt.UnmarshalData(&arr)
+		c.ackMux.Lock()
+		ch, ok := c.ackChan[pkt.Id()]
+		delete(c.ackChan, pkt.Id())
+		c.ackMux.Unlock()
+		if ok {
+			ch <- arr
+		}
+	}
+}
+
+func (c *Conn) sendAck(namespace string, id int, args []any) error {
+	pkt := socket.NewPacket(socket.ACK, namespace)
+	pkt.SetId(id)
+	if args == nil {
+		args = []any{}
+	}
+	if err := pkt.SetData(args...); err != nil {
+		return err
+	}
+	return c.writePacket(pkt)
+}
+
+// Emit sends an event to the client
+func (c *Conn) Emit(namespace string, event string, args ...any) error {
+	pkt := socket.NewPacket(socket.EVENT, namespace)
+	if err := pkt.SetData(append([]any{event}, args...)...); err != nil {
+		return err
+	}
+	return c.writePacket(pkt)
+}
+
+// EmitWithAck sends an event to the client and waits for its ack
+func (c *Conn) EmitWithAck(ctx context.Context, namespace string, event string, args ...any) ([]json.RawMessage, error) {
+	pkt := socket.NewPacket(socket.EVENT, namespace)
+	if err := pkt.SetData(append([]any{event}, args...)...); err != nil {
+		return nil, err
+	}
+	ch := make(chan []json.RawMessage, 1)
+	c.ackMux.Lock()
+	id := c.ackId
+	c.ackId++
+	c.ackChan[id] = ch
+	c.ackMux.Unlock()
+	pkt.SetId(id)
+	if err := c.writePacket(pkt); err != nil {
+		return nil, err
+	}
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-c.closed:
+		return nil, ErrConnClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Disconnect sends a Socket.IO DISCONNECT packet for the namespace
+func (c *Conn) Disconnect(namespace string) error {
+	return c.writePacket(socket.NewPacket(socket.DISCONNECT, namespace))
+}
+
+// Close sends an Engine.IO CLOSE packet and closes the connection
+func (c *Conn) Close() error {
+	err := c.writeEngine(engine.CLOSE, nil)
+	c.Drop()
+	return err
+}
+
+// Drop closes the underlying connection without any notification
+func (c *Conn) Drop() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.wsconn.Close()
+	})
+}
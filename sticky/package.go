@@ -0,0 +1,28 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// package sticky implements a reverse proxy which pins the Engine.IO sessions to one backend,
+// since the polling transport breaks when the requests of a session reach different processes.
+//
+//	backends := []*url.URL{{Scheme: "http", Host: "127.0.0.1:8001"}, {Scheme: "http", Host: "127.0.0.1:8002"}}
+//	http.ListenAndServe(":8000", sticky.New(backends...))
+//
+// Sessions are routed by their sid, which is learnt from the polling handshake responses,
+// and optionally by a cookie which the proxy sets on the handshakes
+package sticky
@@ -0,0 +1,165 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sticky
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type session struct {
+	backend  int
+	lastSeen time.Time
+}
+
+// Proxy is a reverse proxy which routes each Engine.IO session to the same backend
+type Proxy struct {
+	// Cookie is the name of the cookie which holds the backend of the client,
+	// empty means only route by sid
+	Cookie string
+	// SessionTTL is the idle duration after which a session is forgotten, default is 2 minutes
+	SessionTTL time.Duration
+	// Transport is used to send the proxied requests, default is http.DefaultTransport
+	Transport http.RoundTripper
+
+	backends []*url.URL
+	next     atomic.Uint32
+
+	mux       sync.Mutex
+	sessions  map[string]*session
+	lastSweep time.Time
+}
+
+var _ http.Handler = (*Proxy)(nil)
+
+func New(backends ...*url.URL) *Proxy {
+	return &Proxy{
+		backends: backends,
+		sessions: make(map[string]*session),
+	}
+}
+
+func (p *Proxy) sessionTTL() time.Duration {
+	if p.SessionTTL > 0 {
+		return p.SessionTTL
+	}
+	return 2 * time.Minute
+}
+
+// Backend returns the index of the backend which the request is routed to,
+// and whether it belongs to a known session
+func (p *Proxy) Backend(req *http.Request) (backend int, sticky bool) {
+	if sid := req.URL.Query().Get("sid"); sid != "" {
+		p.mux.Lock()
+		s, ok := p.sessions[sid]
+		if ok {
+			s.lastSeen = time.Now()
+		}
+		p.mux.Unlock()
+		if ok {
+			return s.backend, true
+		}
+	}
+	if p.Cookie != "" {
+		if c, err := req.Cookie(p.Cookie); err == nil {
+			if i, err := strconv.Atoi(c.Value); err == nil && 0 <= i && i < len(p.backends) {
+				return i, true
+			}
+		}
+	}
+	return (int)(p.next.Add(1)-1) % len(p.backends), false
+}
+
+func (p *Proxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if len(p.backends) == 0 {
+		http.Error(rw, "no backend", http.StatusBadGateway)
+		return
+	}
+	backend, sticky := p.Backend(req)
+	if !sticky && p.Cookie != "" {
+		http.SetCookie(rw, &http.Cookie{
+			Name:     p.Cookie,
+			Value:    strconv.Itoa(backend),
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	target := p.backends[backend]
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		Transport: p.Transport,
+		ModifyResponse: func(resp *http.Response) error {
+			return p.learnSid(resp, backend)
+		},
+	}
+	proxy.ServeHTTP(rw, req)
+}
+
+// learnSid records the sid of a polling handshake response
+func (p *Proxy) learnSid(resp *http.Response, backend int) error {
+	if resp.StatusCode != http.StatusOK || resp.Request.Method != http.MethodGet ||
+		resp.Request.URL.Query().Get("sid") != "" || resp.Request.URL.Query().Get("transport") != "polling" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// the handshake payload starts with the OPEN packet
+	if i := bytes.IndexByte(body, '\x1e'); i >= 0 {
+		body = body[:i]
+	}
+	if len(body) == 0 || body[0] != '0' {
+		return nil
+	}
+	var open struct {
+		Sid string `json:"sid"`
+	}
+	if json.Unmarshal(body[1:], &open) != nil || open.Sid == "" {
+		return nil
+	}
+	now := time.Now()
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.sessions[open.Sid] = &session{backend: backend, lastSeen: now}
+	if ttl := p.sessionTTL(); now.Sub(p.lastSweep) > ttl {
+		p.lastSweep = now
+		for sid, s := range p.sessions {
+			if now.Sub(s.lastSeen) > ttl {
+				delete(p.sessions, sid)
+			}
+		}
+	}
+	return nil
+}
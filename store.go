@@ -0,0 +1,162 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// StoredPacket is an encoded packet emitted while the socket was not connected
+type StoredPacket struct {
+	Text        []byte
+	Attachments [][]byte
+}
+
+// Store persists the packets emitted while the socket is not connected,
+// so they survive process restarts and are flushed after the next connect
+type Store interface {
+	// Append adds a packet to the end of the queue
+	Append(pkt StoredPacket) error
+	// Load returns all queued packets in order
+	Load() ([]StoredPacket, error)
+	// Clear removes all queued packets
+	Clear() error
+}
+
+var errCorruptedStore = errors.New("Socket.IO: store file is corrupted")
+
+// FileStore is a Store backed by an append-only file
+type FileStore struct {
+	mux  sync.Mutex
+	file *os.File
+}
+
+var _ Store = (*FileStore)(nil)
+
+func NewFileStore(path string) (*FileStore, error) {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{file: fd}, nil
+}
+
+// Append writes the record <parts count> (<part length> <part>)... with uint32 big endian numbers
+func (f *FileStore) Append(pkt StoredPacket) error {
+	parts := 1 + len(pkt.Attachments)
+	size := 4 + 4 + len(pkt.Text)
+	for _, a := range pkt.Attachments {
+		size += 4 + len(a)
+	}
+	buf := make([]byte, 0, size)
+	buf = binary.BigEndian.AppendUint32(buf, (uint32)(parts))
+	buf = binary.BigEndian.AppendUint32(buf, (uint32)(len(pkt.Text)))
+	buf = append(buf, pkt.Text...)
+	for _, a := range pkt.Attachments {
+		buf = binary.BigEndian.AppendUint32(buf, (uint32)(len(a)))
+		buf = append(buf, a...)
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if _, err := f.file.Write(buf); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Load reads the records written by Append, a length which exceeds the rest of the file
+// is reported as corrupted instead of being allocated
+func (f *FileStore) Load() (pkts []StoredPacket, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	stat, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	remain := stat.Size()
+	r := bufio.NewReader(f.file)
+	var num [4]byte
+	readNum := func() (uint32, error) {
+		if _, err := io.ReadFull(r, num[:]); err != nil {
+			return 0, err
+		}
+		remain -= (int64)(len(num))
+		return binary.BigEndian.Uint32(num[:]), nil
+	}
+	readPart := func() ([]byte, error) {
+		n, err := readNum()
+		if err != nil {
+			return nil, err
+		}
+		if (int64)(n) > remain {
+			return nil, errCorruptedStore
+		}
+		part := make([]byte, n)
+		if _, err := io.ReadFull(r, part); err != nil {
+			return nil, err
+		}
+		remain -= (int64)(n)
+		return part, nil
+	}
+	for {
+		var parts uint32
+		if parts, err = readNum(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		// every part has at least its length
+		if parts == 0 || (int64)(parts) > remain/4 {
+			return pkts, errCorruptedStore
+		}
+		var pkt StoredPacket
+		if pkt.Text, err = readPart(); err != nil {
+			return pkts, errCorruptedStore
+		}
+		for i := uint32(1); i < parts; i++ {
+			var a []byte
+			if a, err = readPart(); err != nil {
+				return pkts, errCorruptedStore
+			}
+			pkt.Attachments = append(pkt.Attachments, a)
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+func (f *FileStore) Clear() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.file.Truncate(0)
+}
+
+func (f *FileStore) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,208 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// DefaultStreamChunkSize is the maximum size of a chunk sent by a StreamWriter
+const DefaultStreamChunkSize = 64 * 1024
+
+var errStreamClosed = errors.New("Socket.IO: stream is closed")
+
+// StreamWriter sends the written bytes as a sequence of events on the same name.
+// Each event has the arguments (seq, chunk) where chunk is binary,
+// the end of stream is marked by (seq, null)
+type StreamWriter struct {
+	ChunkSize int
+
+	s     *Socket
+	event string
+
+	mux    sync.Mutex
+	seq    int
+	closed bool
+}
+
+var _ io.WriteCloser = (*StreamWriter)(nil)
+
+func (s *Socket) NewStreamWriter(event string) *StreamWriter {
+	return &StreamWriter{
+		ChunkSize: DefaultStreamChunkSize,
+		s:         s,
+		event:     event,
+	}
+}
+
+func (w *StreamWriter) Write(p []byte) (n int, err error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return 0, errStreamClosed
+	}
+	size := w.ChunkSize
+	if size <= 0 {
+		size = DefaultStreamChunkSize
+	}
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		if err = w.s.Emit(w.event, w.seq, &Buffer{B: chunk}); err != nil {
+			return
+		}
+		w.seq++
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return
+}
+
+// Close sends the end of stream marker
+func (w *StreamWriter) Close() (err error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	return w.s.Emit(w.event, w.seq, nil)
+}
+
+// StreamReader receives the chunks sent by a StreamWriter on the same event name,
+// chunks are reordered by their sequence number
+type StreamReader struct {
+	event string
+	// cancels removes the handlers registered on the socket
+	cancels []func()
+
+	mux     sync.Mutex
+	cond    sync.Cond
+	next    int
+	pending map[int][]byte
+	buf     []byte
+	end     int // sequence number of the end marker, -1 if not received
+	err     error
+}
+
+var _ io.ReadCloser = (*StreamReader)(nil)
+
+func (s *Socket) NewStreamReader(event string) (r *StreamReader) {
+	r = &StreamReader{
+		event:   event,
+		pending: make(map[int][]byte),
+		end:     -1,
+	}
+	r.cond.L = &r.mux
+	r.cancels = []func(){
+		s.onReceivedEvent(func(s *Socket, e *receivedEvent) {
+			r.onEvent(e)
+		}),
+		s.disconnectHandles.On(func(*Socket, string) {
+			r.fail(io.ErrUnexpectedEOF)
+		}),
+	}
+	return
+}
+
+func (r *StreamReader) onEvent(e *receivedEvent) {
+	if e.name != r.event || len(e.args) < 2 {
+		return
+	}
+	var (
+		seq   int
+		chunk Buffer
+	)
+	if err := e.args[0].As(&seq); err != nil {
+		return
+	}
+	if err := e.args[1].As(&chunk); err != nil {
+		return
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.err != nil || seq < r.next {
+		return
+	}
+	if chunk.num == 0 {
+		r.end = seq
+	} else {
+		r.pending[seq] = chunk.B
+	}
+	for {
+		b, ok := r.pending[r.next]
+		if !ok {
+			break
+		}
+		delete(r.pending, r.next)
+		r.buf = append(r.buf, b...)
+		r.next++
+	}
+	if r.next == r.end {
+		r.err = io.EOF
+	}
+	r.cond.Broadcast()
+}
+
+func (r *StreamReader) fail(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.err == nil {
+		r.err = err
+		r.cond.Broadcast()
+	}
+}
+
+// Read blocks until data is available, it returns io.EOF after the end of stream marker,
+// or io.ErrUnexpectedEOF if the socket disconnected before that
+func (r *StreamReader) Read(p []byte) (n int, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for len(r.buf) == 0 && r.err == nil {
+		r.cond.Wait()
+	}
+	if len(r.buf) == 0 {
+		return 0, r.err
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return
+}
+
+// Close stops receiving and removes the handlers from the socket, buffered data is discarded
+func (r *StreamReader) Close() error {
+	for _, cancel := range r.cancels {
+		cancel()
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.buf = nil
+	r.pending = nil
+	if r.err == nil || r.err == io.EOF {
+		r.err = errStreamClosed
+	}
+	r.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,21 @@
+// The reference server of the conformance checks, requires socket.io v4:
+//
+//   npm install socket.io@4 && PORT=3000 node server.js
+//   SOCKETIO_CONFORMANCE_HOST=127.0.0.1:3000 go test -run Conformance github.com/ahollic/socket.io
+const { Server } = require("socket.io");
+
+const io = new Server(Number(process.env.PORT || 3000), {
+  connectionStateRecovery: {},
+});
+
+const handler = (socket) => {
+  socket.on("echo", (...args) => socket.emit("echo", ...args));
+  socket.on("ack", (...args) => {
+    const cb = args.pop();
+    cb(...args);
+  });
+  socket.on("close-transport", () => socket.conn.close());
+};
+
+io.on("connection", handler);
+io.of("/custom").on("connection", handler);
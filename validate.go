@@ -0,0 +1,108 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Validator checks the arguments of an incoming event before the handlers run
+type Validator interface {
+	Validate(event string, args []Arg) error
+}
+
+// ValidatorFunc is a function which implements Validator
+type ValidatorFunc func(event string, args []Arg) error
+
+func (f ValidatorFunc) Validate(event string, args []Arg) error {
+	return f(event, args)
+}
+
+// ValidationError is reported by OnError when the arguments of an event were rejected by its validator,
+// the event is dropped
+type ValidationError struct {
+	Event string
+	Err   error
+}
+
+var _ error = (*ValidationError)(nil)
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Socket.IO: invalid arguments of event %q: %v", e.Event, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// WithValidator sets the validator of the event, it receives the arguments after the payload codecs
+func WithValidator(event string, v Validator) Option {
+	return func(s *Socket) {
+		if s.validators == nil {
+			s.validators = make(map[string]Validator)
+		}
+		s.validators[event] = v
+	}
+}
+
+// ArgCountError is returned by the validators of Args when the number of arguments does not match
+type ArgCountError struct {
+	Want, Got int
+}
+
+var _ error = (*ArgCountError)(nil)
+
+func (e *ArgCountError) Error() string {
+	return fmt.Sprintf("expect %d arguments, got %d", e.Want, e.Got)
+}
+
+// Args returns a validator which requires the arguments to decode into the given types strictly,
+// unknown object fields are rejected.
+// If a type implements interface{ Validate() error }, it is called after the decoding
+func Args(types ...func() any) Validator {
+	return ValidatorFunc(func(_ string, args []Arg) error {
+		if len(args) < len(types) {
+			return &ArgCountError{Want: len(types), Got: len(args)}
+		}
+		for i, newValue := range types {
+			v := newValue()
+			dec := json.NewDecoder(bytes.NewReader(args[i].raw))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(v); err != nil {
+				return fmt.Errorf("argument %d: %w", i, err)
+			}
+			if vd, ok := v.(interface{ Validate() error }); ok {
+				if err := vd.Validate(); err != nil {
+					return fmt.Errorf("argument %d: %w", i, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ArgOf returns a constructor of *T for Args
+func ArgOf[T any]() func() any {
+	return func() any {
+		return new(T)
+	}
+}
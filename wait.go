@@ -0,0 +1,94 @@
+/**
+ * Golang socket.io
+ * Copyright (C) 2024 Kevin Z <zyxkad@gmail.com>
+ * All rights reserved
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU Affero General Public License as published
+ *  by the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU Affero General Public License for more details.
+ *
+ *  You should have received a copy of the GNU Affero General Public License
+ *  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package socket
+
+import (
+	"context"
+)
+
+// WaitConnected blocks until the namespace is connected, or the context is done
+func (s *Socket) WaitConnected(ctx context.Context) error {
+	done := make(chan struct{}, 1)
+	cancel := s.connectHandles.On(func(*Socket, string) {
+		select {
+		case done <- struct{}{}:
+		default:
+		}
+	})
+	defer cancel()
+	if s.Status() == SocketConnected {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// ConnectAndWait connects to the namespace and blocks until the server accepted the connection.
+// It returns the *ConnectError if the server refused it
+func (s *Socket) ConnectAndWait(ctx context.Context, namespace string) (err error) {
+	refused := make(chan error, 1)
+	cancel := s.errorHandles.On(func(_ *Socket, err error) {
+		if ce, ok := err.(*ConnectError); ok {
+			select {
+			case refused <- ce:
+			default:
+			}
+		}
+	})
+	defer cancel()
+	if err = s.Connect(namespace); err != nil {
+		return
+	}
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	go func() {
+		select {
+		case err := <-refused:
+			stop(err)
+		case <-ctx.Done():
+		}
+	}()
+	return s.WaitConnected(ctx)
+}
+
+// WaitClosed blocks until the namespace is disconnected, or the context is done
+func (s *Socket) WaitClosed(ctx context.Context) error {
+	done := make(chan struct{}, 1)
+	cancel := s.disconnectHandles.On(func(*Socket, string) {
+		select {
+		case done <- struct{}{}:
+		default:
+		}
+	})
+	defer cancel()
+	if s.Status() == SocketClosed {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}